@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------- Admin handlers --------
+
+type adminUserInfo struct {
+	Username string     `json:"username"`
+	Role     string     `json:"role"`
+	State    *UserState `json:"state,omitempty"`
+}
+
+type adminUsersResponse struct {
+	Users []adminUserInfo `json:"users"`
+}
+
+// adminListUsersHandler returns every configured user with their role and full state.
+func adminListUsersHandler(c *gin.Context) {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
+	users := make([]adminUserInfo, 0, len(usersByUsername))
+	for username, user := range usersByUsername {
+		users = append(users, adminUserInfo{
+			Username: username,
+			Role:     user.GetRole(),
+			State:    state.Users[username],
+		})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	c.JSON(http.StatusOK, adminUsersResponse{Users: users})
+}
+
+type adminQuestionsResponse struct {
+	Questions []Question `json:"questions"`
+}
+
+func adminListQuestionsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, adminQuestionsResponse{Questions: sortedQuestions(snapshotQuestions())})
+}
+
+func adminCreateQuestionHandler(c *gin.Context) {
+	var q Question
+	if err := c.ShouldBindJSON(&q); err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
+		return
+	}
+	if err := validateQuestion(q); err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: err.Error()})
+		return
+	}
+
+	err := editQuestions(func(questions map[int]Question) error {
+		if _, exists := questions[q.ID]; exists {
+			return errQuestionExists
+		}
+		questions[q.ID] = q
+		return nil
+	})
+	if err != nil {
+		respondQuestionEditError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, q)
+}
+
+func adminUpdateQuestionHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid question id"})
+		return
+	}
+	var q Question
+	if err := c.ShouldBindJSON(&q); err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
+		return
+	}
+	// the id in the path wins, the body may omit it
+	q.ID = id
+	if err := validateQuestion(q); err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: err.Error()})
+		return
+	}
+
+	err = editQuestions(func(questions map[int]Question) error {
+		if _, exists := questions[id]; !exists {
+			return errQuestionNotFound
+		}
+		questions[id] = q
+		return nil
+	})
+	if err != nil {
+		respondQuestionEditError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
+
+func adminSetQuestionDisabledHandler(disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid question id"})
+			return
+		}
+
+		var updated Question
+		err = editQuestions(func(questions map[int]Question) error {
+			q, exists := questions[id]
+			if !exists {
+				return errQuestionNotFound
+			}
+			q.Disabled = disabled
+			questions[id] = q
+			updated = q
+			return nil
+		})
+		if err != nil {
+			respondQuestionEditError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// adminReloadQuestionsHandler re-reads the questions after they were edited by hand.
+func adminReloadQuestionsHandler(c *gin.Context) {
+	questionsEditMu.Lock()
+	defer questionsEditMu.Unlock()
+
+	questions, err := dataStore.LoadQuestions()
+	if err == nil {
+		err = setQuestionList(questions)
+	}
+	if err != nil {
+		log.Printf("questions reload failed: %v", err)
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "reload failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, baseResponse{OK: true, Description: "questions reloaded"})
+}
+
+var (
+	errQuestionExists   = errors.New("question already exists")
+	errQuestionNotFound = errors.New("unknown question")
+)
+
+// editQuestions applies fn to a copy of the questions, saves the result to
+// the store and only then swaps it in, so a failed write changes nothing.
+func editQuestions(fn func(questions map[int]Question) error) error {
+	questionsEditMu.Lock()
+	defer questionsEditMu.Unlock()
+
+	questions := snapshotQuestions()
+	if err := fn(questions); err != nil {
+		return err
+	}
+	if err := validatePrerequisites(questions); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidQuestions, err)
+	}
+	if err := dataStore.SaveQuestions(sortedQuestions(questions)); err != nil {
+		log.Printf("failed to persist questions: %v", err)
+		return err
+	}
+	setQuestions(questions)
+	return nil
+}
+
+func respondQuestionEditError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errQuestionExists):
+		c.JSON(http.StatusConflict, baseResponse{OK: false, Description: err.Error()})
+	case errors.Is(err, errQuestionNotFound):
+		c.JSON(http.StatusNotFound, baseResponse{OK: false, Description: err.Error()})
+	case errors.Is(err, errInvalidQuestions):
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to save questions"})
+	}
+}
+
+// adminRescorePreviewHandler shows per user what a rescore would change.
+func adminRescorePreviewHandler(c *gin.Context) {
+	diffs := previewRescore()
+	c.JSON(http.StatusOK, rescoreResponse{Applied: false, Changed: len(diffs), Users: diffs})
+}
+
+// adminRescoreApplyHandler recomputes all scores from attempt history and saves the state.
+func adminRescoreApplyHandler(c *gin.Context) {
+	diffs := rescoreAll()
+	log.Printf("rescore applied, %d users changed", len(diffs))
+	// rescoring rewrites past attempts which are not events, snapshot right away
+	persister.MarkDirty()
+	if err := persister.Flush(); err != nil {
+		c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "rescore applied but saving state failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rescoreResponse{Applied: true, Changed: len(diffs), Users: diffs})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminQuestionHandlersRejectEmptyAnswers(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		body    string
+	}{
+		{"create", adminCreateQuestionHandler, `{"id": 2, "answer": "", "score": 10}`},
+		{"create blank", adminCreateQuestionHandler, `{"id": 2, "answer": " ", "score": 10}`},
+		{"update", adminUpdateQuestionHandler, `{"answer": "", "score": 10}`},
+		{"update empty regex", adminUpdateQuestionHandler, `{"answer": ".*", "match_mode": "regex", "score": 10}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupHandlerTest(t, map[int]Question{1: {ID: 1, Answer: "x"}})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/admin/questions", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{{Key: "id", Value: "1"}}
+			tt.handler(c)
+
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "non-empty answer") {
+				t.Errorf("response = %d %s, want 400", w.Code, w.Body.String())
+			}
+			if q, _ := getQuestion(1); q.Answer != "x" {
+				t.Errorf("question 1 changed to %+v", q)
+			}
+			if _, ok := getQuestion(2); ok {
+				t.Error("question 2 created")
+			}
+		})
+	}
+}
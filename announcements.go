@@ -0,0 +1,260 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------- Announcements and clarifications --------
+
+const (
+	maxMessageLength       = 2000 // runes, announcements, clarifications and replies
+	maxPendingPerUser      = 5    // unanswered clarifications a team may have open
+	clarificationsPending  = "pending"
+	clarificationsAnswered = "answered"
+)
+
+type announcementRequest struct {
+	QuestionID int    `json:"question_id"`
+	Text       string `json:"text"`
+}
+
+type clarificationRequest struct {
+	QuestionID int    `json:"question_id"`
+	Text       string `json:"text"`
+}
+
+type clarificationReplyRequest struct {
+	Reply  string `json:"reply"`
+	Public bool   `json:"public"`
+}
+
+type announcementsResponse struct {
+	Announcements []Announcement `json:"announcements"`
+}
+
+type clarificationsResponse struct {
+	Clarifications []Clarification `json:"clarifications"`
+}
+
+// messageText trims text and checks it is neither empty nor too long. It
+// writes the error response and returns false otherwise.
+func messageText(c *gin.Context, text, field string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: field + " must not be empty"})
+		return "", false
+	}
+	if utf8.RuneCountInString(text) > maxMessageLength {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: field + " is too long"})
+		return "", false
+	}
+	return text, true
+}
+
+// findClarification returns the clarification with id, nil if there is none.
+func findClarification(st *InMemoryState, id int) *Clarification {
+	// IDs are positions, the loop only guards against a damaged state
+	if id >= 1 && id <= len(st.Clarifications) && st.Clarifications[id-1].ID == id {
+		return &st.Clarifications[id-1]
+	}
+	for i := range st.Clarifications {
+		if st.Clarifications[i].ID == id {
+			return &st.Clarifications[i]
+		}
+	}
+	return nil
+}
+
+// publicClarification is what other teams see of a public clarification.
+func publicClarification(cl Clarification) Clarification {
+	cl.Username = ""
+	cl.RepliedBy = ""
+	return cl
+}
+
+// announcementsHandler lists announcements, newest first. It needs no login
+// so it can be shown before the competition starts.
+func announcementsHandler(c *gin.Context) {
+	stateMu.RLock()
+	announcements := make([]Announcement, len(state.Announcements))
+	for i, a := range state.Announcements {
+		announcements[len(announcements)-1-i] = a
+	}
+	stateMu.RUnlock()
+	c.JSON(http.StatusOK, announcementsResponse{Announcements: announcements})
+}
+
+func adminCreateAnnouncementHandler(c *gin.Context) {
+	var req announcementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
+		return
+	}
+	text, ok := messageText(c, req.Text, "text")
+	if !ok {
+		return
+	}
+	if req.QuestionID != 0 {
+		if _, ok := getQuestion(req.QuestionID); !ok {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "question not found"})
+			return
+		}
+	}
+	claims := c.MustGet(claimsKey).(*Claims)
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	announcement := Announcement{
+		ID:         len(state.Announcements) + 1,
+		QuestionID: req.QuestionID,
+		Text:       text,
+		Author:     claims.Username,
+		At:         time.Now(),
+	}
+	if err := recordEvent(stateEvent{Type: eventAnnouncement, Username: claims.Username, Announcement: &announcement}); err != nil {
+		c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to record announcement"})
+		return
+	}
+	log.Printf("announcement %d by %s", announcement.ID, claims.Username)
+	c.JSON(http.StatusOK, announcement)
+}
+
+// createClarificationHandler lets a team ask the organisers about a question.
+func createClarificationHandler(c *gin.Context) {
+	var req clarificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
+		return
+	}
+	text, ok := messageText(c, req.Text, "text")
+	if !ok {
+		return
+	}
+	q, ok := getQuestion(req.QuestionID)
+	if !ok || q.Disabled {
+		c.JSON(http.StatusNotFound, baseResponse{OK: false, Description: "question not found"})
+		return
+	}
+	claims := c.MustGet(claimsKey).(*Claims)
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	pending := 0
+	for _, cl := range state.Clarifications {
+		if cl.Username == claims.Username && cl.RepliedAt == nil {
+			pending++
+		}
+	}
+	if pending >= maxPendingPerUser {
+		c.JSON(http.StatusTooManyRequests, baseResponse{OK: false, Description: "too many unanswered clarifications"})
+		return
+	}
+
+	clarification := Clarification{
+		ID:         len(state.Clarifications) + 1,
+		Username:   claims.Username,
+		QuestionID: q.ID,
+		Text:       text,
+		At:         time.Now(),
+	}
+	if err := recordEvent(stateEvent{Type: eventClarification, Username: claims.Username, QuestionID: q.ID, Clarification: &clarification}); err != nil {
+		c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to record clarification"})
+		return
+	}
+	c.JSON(http.StatusOK, clarification)
+}
+
+// clarificationsHandler lists the team's own clarifications and every public
+// one, newest first.
+func clarificationsHandler(c *gin.Context) {
+	claims := c.MustGet(claimsKey).(*Claims)
+
+	stateMu.RLock()
+	clarifications := []Clarification{}
+	for i := len(state.Clarifications) - 1; i >= 0; i-- {
+		cl := state.Clarifications[i]
+		switch {
+		case cl.Username == claims.Username:
+			clarifications = append(clarifications, cl)
+		case cl.Public && cl.RepliedAt != nil:
+			clarifications = append(clarifications, publicClarification(cl))
+		}
+	}
+	stateMu.RUnlock()
+	c.JSON(http.StatusOK, clarificationsResponse{Clarifications: clarifications})
+}
+
+// adminClarificationsHandler lists every clarification, newest first;
+// ?status=pending or ?status=answered filters them.
+func adminClarificationsHandler(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != clarificationsPending && status != clarificationsAnswered {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "status must be pending or answered"})
+		return
+	}
+
+	stateMu.RLock()
+	clarifications := []Clarification{}
+	for i := len(state.Clarifications) - 1; i >= 0; i-- {
+		cl := state.Clarifications[i]
+		answered := cl.RepliedAt != nil
+		if status == "" || (status == clarificationsAnswered) == answered {
+			clarifications = append(clarifications, cl)
+		}
+	}
+	stateMu.RUnlock()
+	c.JSON(http.StatusOK, clarificationsResponse{Clarifications: clarifications})
+}
+
+// adminReplyClarificationHandler answers a clarification, to the team that
+// asked or with "public" to everyone. Replying again replaces the answer.
+func adminReplyClarificationHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid clarification id"})
+		return
+	}
+	var req clarificationReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
+		return
+	}
+	reply, ok := messageText(c, req.Reply, "reply")
+	if !ok {
+		return
+	}
+	claims := c.MustGet(claimsKey).(*Claims)
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	existing := findClarification(state, id)
+	if existing == nil {
+		c.JSON(http.StatusNotFound, baseResponse{OK: false, Description: "clarification not found"})
+		return
+	}
+	answered := *existing
+	now := time.Now()
+	answered.Reply = reply
+	answered.Public = req.Public
+	answered.RepliedBy = claims.Username
+	answered.RepliedAt = &now
+	err = recordEvent(stateEvent{
+		Type:          eventClarificationReply,
+		Username:      answered.Username,
+		QuestionID:    answered.QuestionID,
+		Clarification: &answered,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to record reply"})
+		return
+	}
+	log.Printf("clarification %d answered by %s (public: %t)", id, claims.Username, req.Public)
+	c.JSON(http.StatusOK, answered)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveAs runs handler for username with a JSON body and, for replies, the
+// clarification id.
+func serveAs(handler gin.HandlerFunc, username, body string, id int) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(id)}}
+	c.Set(claimsKey, &Claims{Username: username})
+	handler(c)
+	return w
+}
+
+func listClarifications(t *testing.T, username string) []Clarification {
+	t.Helper()
+	w := serveAs(clarificationsHandler, username, "", 0)
+	var resp clarificationsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Clarifications
+}
+
+func askClarification(t *testing.T, username, text string) {
+	t.Helper()
+	if w := serveAs(createClarificationHandler, username, `{"question_id": 1, "text": "`+text+`"}`, 0); w.Code != http.StatusOK {
+		t.Fatalf("%s asking = %d %s", username, w.Code, w.Body.String())
+	}
+}
+
+func replyClarification(t *testing.T, id int, body string) {
+	t.Helper()
+	if w := serveAs(adminReplyClarificationHandler, "organiser", body, id); w.Code != http.StatusOK {
+		t.Fatalf("reply to %d = %d %s", id, w.Code, w.Body.String())
+	}
+}
+
+func TestClarificationVisibility(t *testing.T) {
+	setupHandlerTest(t, map[int]Question{1: {ID: 1, Answer: "x"}})
+	askClarification(t, "a", "private")
+	askClarification(t, "a", "unanswered")
+	askClarification(t, "b", "public")
+	replyClarification(t, 1, `{"reply": "to a"}`)
+	replyClarification(t, 3, `{"reply": "to all", "public": true}`)
+
+	tests := []struct {
+		username string
+		want     []string // "id:username", newest first
+	}{
+		{"a", []string{"3:", "2:a", "1:a"}},
+		{"b", []string{"3:b"}},
+		{"c", []string{"3:"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, cl := range listClarifications(t, tt.username) {
+			got = append(got, strconv.Itoa(cl.ID)+":"+cl.Username)
+			if cl.ID == 3 && cl.Username == "" && cl.RepliedBy != "" {
+				t.Errorf("%s sees who replied: %+v", tt.username, cl)
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s sees %v, want %v", tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestClarificationPendingLimit(t *testing.T) {
+	setupHandlerTest(t, map[int]Question{1: {ID: 1, Answer: "x"}})
+	for i := 0; i < maxPendingPerUser; i++ {
+		askClarification(t, "a", "question")
+	}
+	if w := serveAs(createClarificationHandler, "a", `{"question_id": 1, "text": "one more"}`, 0); w.Code != http.StatusTooManyRequests {
+		t.Errorf("asking past the limit = %d %s, want 429", w.Code, w.Body.String())
+	}
+	// the limit is per team, and an answer frees a slot
+	askClarification(t, "b", "question")
+	replyClarification(t, 2, `{"reply": "done"}`)
+	askClarification(t, "a", "one more")
+}
+
+func TestClarificationReplyPersists(t *testing.T) {
+	store := setupHandlerTest(t, map[int]Question{1: {ID: 1, Answer: "x"}})
+	askClarification(t, "a", "why?")
+	replyClarification(t, 1, `{"reply": "first"}`)
+	replyClarification(t, 1, `{"reply": "second", "public": true}`)
+
+	if w := serveAs(adminReplyClarificationHandler, "organiser", `{"reply": "x"}`, 9); w.Code != http.StatusNotFound {
+		t.Errorf("reply to a missing clarification = %d, want 404", w.Code)
+	}
+	if w := serveAs(adminReplyClarificationHandler, "organiser", `{"reply": "  "}`, 1); w.Code != http.StatusBadRequest {
+		t.Errorf("empty reply = %d, want 400", w.Code)
+	}
+
+	// replaying the journal gives the latest reply
+	replayed := newTestState(0)
+	for _, e := range store.events {
+		applyEvent(replayed, e)
+	}
+	for _, st := range []*InMemoryState{state, replayed} {
+		cl := findClarification(st, 1)
+		if cl == nil || cl.Reply != "second" || !cl.Public || cl.RepliedBy != "organiser" || cl.RepliedAt == nil || cl.Username != "a" {
+			t.Errorf("clarification = %+v, want the public second reply", cl)
+		}
+	}
+	if len(store.events) != 3 {
+		t.Errorf("recorded %d events, want the question and two replies", len(store.events))
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// -------- Configuration --------
+
+const (
+	// placeholder secret shipped with older builds, never accepted at startup
+	defaultJWTSecretPlaceholder = "replace-with-strong-secret"
+	minJWTSecretLength          = 32
+)
+
+// Config holds everything that changes from one event to the next.
+// Values are resolved in order: defaults, config file, environment, CLI flags.
+type Config struct {
+	// http server
+	ServerAddress  string   `yaml:"server_address" json:"server_address"`
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins"`
+	// how long to wait for in-flight requests on SIGINT/SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+	// reverse proxies whose X-Forwarded-For is believed, IPs or CIDRs;
+	// unset trusts none and uses the peer address
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies"`
+
+	// auth
+	JWTSecret     string        `yaml:"jwt_secret" json:"jwt_secret"`
+	JWTCookieName string        `yaml:"jwt_cookie_name" json:"jwt_cookie_name"`
+	JWTExpiration time.Duration `yaml:"jwt_expiration" json:"jwt_expiration"`
+
+	// failed logins per username and per IP before they are locked out for
+	// LoginBackoff, doubling with every further failure up to LoginMaxBackoff.
+	// IPs get more tries, teams at a venue often share one.
+	LoginMaxFailures   int           `yaml:"login_max_failures" json:"login_max_failures"`
+	LoginMaxIPFailures int           `yaml:"login_max_ip_failures" json:"login_max_ip_failures"`
+	LoginBackoff       time.Duration `yaml:"login_backoff" json:"login_backoff"`
+	LoginMaxBackoff    time.Duration `yaml:"login_max_backoff" json:"login_max_backoff"`
+
+	// accept unhashed passwords in users.json, only for old event files
+	AllowPlaintextPasswords bool `yaml:"allow_plaintext_passwords" json:"allow_plaintext_passwords"`
+
+	// storage backend, "json" or "sqlite"
+	Storage        string `yaml:"storage" json:"storage"`
+	SQLiteFilePath string `yaml:"sqlite_file" json:"sqlite_file"`
+
+	// answer normalization steps to change from the defaults, see normalize.go
+	Normalization NormalizationOptions `yaml:"normalization" json:"normalization"`
+
+	// when submissions are accepted and the scoreboard freezes
+	Schedule Schedule `yaml:"schedule" json:"schedule"`
+
+	// token bucket on /submit_answer per user and question: up to SubmitBurst
+	// answers at once, refilled by one every SubmitInterval; 0 disables it
+	SubmitBurst    int           `yaml:"submit_burst" json:"submit_burst"`
+	SubmitInterval time.Duration `yaml:"submit_interval" json:"submit_interval"`
+
+	// how often dirty state is snapshotted to the store
+	PersistInterval time.Duration `yaml:"persist_interval" json:"persist_interval"`
+
+	// data files, with sqlite they only seed an empty database
+	UsersFilePath     string `yaml:"users_file" json:"users_file"`
+	QuestionsFilePath string `yaml:"questions_file" json:"questions_file"`
+	StateFilePath     string `yaml:"state_file" json:"state_file"`
+	JournalFilePath   string `yaml:"journal_file" json:"journal_file"`
+
+	// external API, used when llm_providers is not set
+	AvalaiAPIKey string `yaml:"avalai_api_key" json:"avalai_api_key"`
+	AvalaiAPIURL string `yaml:"avalai_api_url" json:"avalai_api_url"`
+
+	// LLM providers by name; system prompts use DefaultLLMProvider unless
+	// SystemPromptProviders maps their ID to another one
+	LLMProviders          map[string]LLMProviderConfig `yaml:"llm_providers" json:"llm_providers"`
+	DefaultLLMProvider    string                       `yaml:"default_llm_provider" json:"default_llm_provider"`
+	SystemPromptProviders map[int]string               `yaml:"system_prompt_providers" json:"system_prompt_providers"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		ServerAddress:   ":8080",
+		ShutdownTimeout: 40 * time.Second, // longer than an LLM call may take
+		AllowedOrigins: []string{
+			"https://hafkhan.vercel.app",
+			"http://localhost:3000", // for local development
+			"http://localhost:5173", // for Vite dev server
+		},
+		JWTCookieName:      "Quiz-Token",
+		JWTExpiration:      24 * time.Hour,
+		LoginMaxFailures:   5,
+		LoginMaxIPFailures: 50,
+		LoginBackoff:       30 * time.Second,
+		LoginMaxBackoff:    15 * time.Minute,
+		PersistInterval:    2 * time.Second,
+		SubmitBurst:        5,
+		SubmitInterval:     10 * time.Second,
+		Storage:            storageJSON,
+		SQLiteFilePath:     "./assets/competition.db",
+		UsersFilePath:      "./assets/users.json",
+		QuestionsFilePath:  "./assets/questions.json",
+		StateFilePath:      "./assets/state.json",
+		JournalFilePath:    "./assets/state.journal",
+		AvalaiAPIURL:       "https://api.avalai.ir/v1/chat/completions",
+		DefaultLLMProvider: defaultLLMProvider,
+	}
+}
+
+// loadConfig builds the configuration from defaults, an optional YAML/JSON
+// file, QUIZ_* environment variables and the given command line arguments.
+func loadConfig(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("QUIZ_CONFIG"), "path to a YAML or JSON config file")
+	addr := fs.String("addr", "", "http listen address")
+	usersFile := fs.String("users", "", "path to users.json")
+	questionsFile := fs.String("questions", "", "path to questions.json")
+	stateFile := fs.String("state", "", "path to state.json")
+	journalFile := fs.String("journal", "", "path to the state write-ahead journal")
+	storage := fs.String("storage", "", "storage backend: json or sqlite")
+	sqliteFile := fs.String("sqlite", "", "path to the sqlite database")
+	allowPlaintext := fs.Bool("allow-plaintext-passwords", false, "accept unhashed passwords in users.json (legacy)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	// CLI flags win over everything else
+	overrideString(&cfg.ServerAddress, *addr)
+	overrideString(&cfg.UsersFilePath, *usersFile)
+	overrideString(&cfg.QuestionsFilePath, *questionsFile)
+	overrideString(&cfg.StateFilePath, *stateFile)
+	overrideString(&cfg.JournalFilePath, *journalFile)
+	overrideString(&cfg.Storage, *storage)
+	overrideString(&cfg.SQLiteFilePath, *sqliteFile)
+	if *allowPlaintext {
+		cfg.AllowPlaintextPasswords = true
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile merges a config file into cfg. JSON is a subset of YAML, so both
+// formats go through the same decoder.
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) applyEnv() error {
+	overrideString(&cfg.ServerAddress, os.Getenv("QUIZ_SERVER_ADDRESS"))
+	overrideString(&cfg.JWTSecret, os.Getenv("QUIZ_JWT_SECRET"))
+	overrideString(&cfg.JWTCookieName, os.Getenv("QUIZ_JWT_COOKIE_NAME"))
+	overrideString(&cfg.UsersFilePath, os.Getenv("QUIZ_USERS_FILE"))
+	overrideString(&cfg.QuestionsFilePath, os.Getenv("QUIZ_QUESTIONS_FILE"))
+	overrideString(&cfg.StateFilePath, os.Getenv("QUIZ_STATE_FILE"))
+	overrideString(&cfg.JournalFilePath, os.Getenv("QUIZ_JOURNAL_FILE"))
+	overrideString(&cfg.Storage, os.Getenv("QUIZ_STORAGE"))
+	overrideString(&cfg.SQLiteFilePath, os.Getenv("QUIZ_SQLITE_FILE"))
+	overrideString(&cfg.AvalaiAPIKey, os.Getenv("QUIZ_AVALAI_API_KEY"))
+	overrideString(&cfg.AvalaiAPIURL, os.Getenv("QUIZ_AVALAI_API_URL"))
+	overrideString(&cfg.DefaultLLMProvider, os.Getenv("QUIZ_DEFAULT_LLM_PROVIDER"))
+
+	if v := os.Getenv("QUIZ_ALLOWED_ORIGINS"); v != "" {
+		cfg.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv("QUIZ_TRUSTED_PROXIES"); v != "" {
+		cfg.TrustedProxies = splitList(v)
+	}
+	if v := os.Getenv("QUIZ_ALLOW_PLAINTEXT_PASSWORDS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("QUIZ_ALLOW_PLAINTEXT_PASSWORDS: %w", err)
+		}
+		cfg.AllowPlaintextPasswords = b
+	}
+	if err := overrideDuration(&cfg.JWTExpiration, "QUIZ_JWT_EXPIRATION"); err != nil {
+		return err
+	}
+	if err := overrideDuration(&cfg.PersistInterval, "QUIZ_PERSIST_INTERVAL"); err != nil {
+		return err
+	}
+	if err := overrideDuration(&cfg.ShutdownTimeout, "QUIZ_SHUTDOWN_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := overrideInt(&cfg.LoginMaxFailures, "QUIZ_LOGIN_MAX_FAILURES"); err != nil {
+		return err
+	}
+	if err := overrideInt(&cfg.LoginMaxIPFailures, "QUIZ_LOGIN_MAX_IP_FAILURES"); err != nil {
+		return err
+	}
+	if err := overrideDuration(&cfg.LoginBackoff, "QUIZ_LOGIN_BACKOFF"); err != nil {
+		return err
+	}
+	if err := overrideDuration(&cfg.LoginMaxBackoff, "QUIZ_LOGIN_MAX_BACKOFF"); err != nil {
+		return err
+	}
+	if err := overrideInt(&cfg.SubmitBurst, "QUIZ_SUBMIT_BURST"); err != nil {
+		return err
+	}
+	if err := overrideDuration(&cfg.SubmitInterval, "QUIZ_SUBMIT_INTERVAL"); err != nil {
+		return err
+	}
+	if err := overrideTime(&cfg.Schedule.StartAt, "QUIZ_START_AT"); err != nil {
+		return err
+	}
+	if err := overrideTime(&cfg.Schedule.EndAt, "QUIZ_END_AT"); err != nil {
+		return err
+	}
+	if err := overrideTime(&cfg.Schedule.FreezeAt, "QUIZ_FREEZE_AT"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate refuses to start with settings that would make the event insecure
+// or that point at data files which do not exist.
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	switch {
+	case cfg.JWTSecret == "":
+		errs = append(errs, errors.New("jwt_secret is required (set QUIZ_JWT_SECRET)"))
+	case cfg.JWTSecret == defaultJWTSecretPlaceholder:
+		errs = append(errs, errors.New("jwt_secret still has the placeholder value"))
+	case len(cfg.JWTSecret) < minJWTSecretLength:
+		errs = append(errs, fmt.Errorf("jwt_secret must be at least %d bytes", minJWTSecretLength))
+	}
+	if cfg.JWTCookieName == "" {
+		errs = append(errs, errors.New("jwt_cookie_name must not be empty"))
+	}
+	if cfg.JWTExpiration <= 0 {
+		errs = append(errs, errors.New("jwt_expiration must be positive"))
+	}
+	if cfg.LoginMaxFailures < 1 || cfg.LoginMaxIPFailures < 1 {
+		errs = append(errs, errors.New("login_max_failures and login_max_ip_failures must be at least 1"))
+	}
+	if cfg.LoginBackoff <= 0 || cfg.LoginMaxBackoff < cfg.LoginBackoff {
+		errs = append(errs, errors.New("login_backoff must be positive and not above login_max_backoff"))
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("trusted_proxies: %q is not an IP or CIDR", proxy))
+			}
+		}
+	}
+	if err := cfg.Normalization.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("normalization: %w", err))
+	}
+	if err := cfg.Schedule.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.PersistInterval <= 0 {
+		errs = append(errs, errors.New("persist_interval must be positive"))
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+	if cfg.SubmitBurst < 0 {
+		errs = append(errs, errors.New("submit_burst must not be negative"))
+	}
+	if cfg.SubmitBurst > 0 && cfg.SubmitInterval <= 0 {
+		errs = append(errs, errors.New("submit_interval must be positive"))
+	}
+	if cfg.ServerAddress == "" {
+		errs = append(errs, errors.New("server_address must not be empty"))
+	}
+	if len(cfg.LLMProviders) == 0 {
+		if cfg.AvalaiAPIURL == "" {
+			errs = append(errs, errors.New("avalai_api_url must not be empty"))
+		}
+		if cfg.AvalaiAPIKey == "" {
+			errs = append(errs, errors.New("avalai_api_key is required (set QUIZ_AVALAI_API_KEY)"))
+		}
+	}
+	providers := cfg.llmProviders()
+	for name, p := range providers {
+		if err := p.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("llm_providers.%s: %w", name, err))
+		}
+	}
+	if _, ok := providers[cfg.DefaultLLMProvider]; !ok {
+		errs = append(errs, fmt.Errorf("default_llm_provider: unknown provider %q", cfg.DefaultLLMProvider))
+	}
+	for id, name := range cfg.SystemPromptProviders {
+		if _, ok := systemPrompts[id]; !ok {
+			errs = append(errs, fmt.Errorf("system_prompt_providers: unknown system prompt %d", id))
+		}
+		if _, ok := providers[name]; !ok {
+			errs = append(errs, fmt.Errorf("system_prompt_providers.%d: unknown provider %q", id, name))
+		}
+	}
+
+	switch cfg.Storage {
+	case storageJSON:
+		if err := requireFile(cfg.UsersFilePath); err != nil {
+			errs = append(errs, fmt.Errorf("users_file: %w", err))
+		}
+		if err := requireFile(cfg.QuestionsFilePath); err != nil {
+			errs = append(errs, fmt.Errorf("questions_file: %w", err))
+		}
+		// the state file may not exist yet, but its directory must
+		if err := requireDir(filepath.Dir(cfg.StateFilePath)); err != nil {
+			errs = append(errs, fmt.Errorf("state_file: %w", err))
+		}
+		if err := requireDir(filepath.Dir(cfg.JournalFilePath)); err != nil {
+			errs = append(errs, fmt.Errorf("journal_file: %w", err))
+		}
+	case storageSQLite:
+		if err := requireDir(filepath.Dir(cfg.SQLiteFilePath)); err != nil {
+			errs = append(errs, fmt.Errorf("sqlite_file: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage must be %q or %q", storageJSON, storageSQLite))
+	}
+
+	return errors.Join(errs...)
+}
+
+func requireFile(path string) error {
+	if path == "" {
+		return errors.New("path is empty")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+func requireDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	return nil
+}
+
+func overrideString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// overrideDuration parses the environment variable env into dst if it is set.
+func overrideDuration(dst *time.Duration, env string) error {
+	v := os.Getenv(env)
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", env, err)
+	}
+	*dst = d
+	return nil
+}
+
+// overrideInt parses the environment variable env into dst if it is set.
+func overrideInt(dst *int, env string) error {
+	v := os.Getenv(env)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", env, err)
+	}
+	*dst = n
+	return nil
+}
+
+// overrideTime parses the RFC 3339 environment variable env into dst if it is set.
+func overrideTime(dst *time.Time, env string) error {
+	v := os.Getenv(env)
+	if v == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", env, err)
+	}
+	*dst = t
+	return nil
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -1,93 +1,203 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 )
 
-func loadUsersFromFile(path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	var list []User
-	if err := json.NewDecoder(f).Decode(&list); err != nil {
-		return err
-	}
+// setUsers validates the user list and replaces the loaded users.
+func setUsers(list []User, allowPlaintext bool) error {
 	tmp := make(map[string]User, len(list))
+	plaintext := 0
 	for _, u := range list {
 		if u.Username == "" {
 			continue
 		}
+		if !validRole(u.Role) {
+			return fmt.Errorf("user %q has unknown role %q", u.Username, u.Role)
+		}
+		if !isPasswordHash(u.Password) {
+			plaintext++
+		}
 		tmp[u.Username] = u
 	}
+	if plaintext > 0 {
+		if !allowPlaintext {
+			return fmt.Errorf("%w: %d users are not hashed, run import-users or set allow_plaintext_passwords", errPlaintextPassword, plaintext)
+		}
+		log.Printf("warning: %d users have plaintext passwords (legacy mode)", plaintext)
+	}
 	usersByUsername = tmp
 	return nil
 }
 
-func loadQuestionsFromFile(path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	var list []Question
-	if err := json.NewDecoder(f).Decode(&list); err != nil {
-		return err
-	}
+// setQuestionList validates the questions and swaps them in.
+func setQuestionList(list []Question) error {
 	tmp := make(map[int]Question, len(list))
 	for _, q := range list {
 		if q.ID == 0 {
 			continue
 		}
+		if err := validateQuestion(q); err != nil {
+			return err
+		}
 		tmp[q.ID] = q
 	}
-	questionsByID = tmp
+	if err := validatePrerequisites(tmp); err != nil {
+		return err
+	}
+	setQuestions(tmp)
 	return nil
 }
 
-// -------- Persistence --------
-func loadStateFromFile(path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
+func validateQuestion(q Question) error {
+	if q.ID == 0 {
+		return errors.New("question id must not be 0")
 	}
-	defer f.Close()
-	var loaded InMemoryState
-	if err := json.NewDecoder(f).Decode(&loaded); err != nil {
-		return err
+	if q.Score < 0 || q.Penalty < 0 || q.PenaltyTryCount < 0 {
+		return fmt.Errorf("question %d: score, penalty and penalty_try_count must not be negative", q.ID)
 	}
-	stateMu.Lock()
-	defer stateMu.Unlock()
-	if loaded.Users == nil {
-		loaded.Users = map[string]*UserState{}
+	if err := q.Normalization.Validate(); err != nil {
+		return fmt.Errorf("question %d: %w", q.ID, err)
+	}
+	if err := validateMatching(q); err != nil {
+		return fmt.Errorf("question %d: %w", q.ID, err)
+	}
+	if err := q.PenaltyPolicy.Validate(); err != nil {
+		return fmt.Errorf("question %d: %w", q.ID, err)
+	}
+	if err := q.Scoring.Validate(); err != nil {
+		return fmt.Errorf("question %d: %w", q.ID, err)
+	}
+	if q.Scoring != nil && q.Scoring.MinScore > q.Score {
+		return fmt.Errorf("question %d: scoring.min_score must not exceed score", q.ID)
+	}
+	for i, h := range q.Hints {
+		if h.Text == "" || h.Cost < 0 {
+			return fmt.Errorf("question %d: hint %d needs a text and a cost that is not negative", q.ID, i)
+		}
 	}
-	state = &loaded
 	return nil
 }
 
-func persistStateToFile(path string) error {
-	stateMu.RLock()
-	defer stateMu.RUnlock()
+// sortedQuestions returns the questions ordered by ID.
+func sortedQuestions(questions map[int]Question) []Question {
+	list := make([]Question, 0, len(questions))
+	for _, q := range questions {
+		list = append(list, q)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
 
-	var writer bytes.Buffer
+// getQuestion returns a copy of the question, safe to use without holding a lock.
+func getQuestion(id int) (Question, bool) {
+	questionsMu.RLock()
+	defer questionsMu.RUnlock()
+	q, ok := questionsByID[id]
+	return q, ok
+}
+
+// snapshotQuestions returns a copy of the question map.
+func snapshotQuestions() map[int]Question {
+	questionsMu.RLock()
+	defer questionsMu.RUnlock()
+	out := make(map[int]Question, len(questionsByID))
+	for id, q := range questionsByID {
+		out[id] = q
+	}
+	return out
+}
 
-	enc := json.NewEncoder(&writer)
-	enc.SetIndent("", "  ")
+func setQuestions(questions map[int]Question) {
+	questionsMu.Lock()
+	defer questionsMu.Unlock()
+	questionsByID = questions
+}
 
-	err := enc.Encode(state)
+// writeFileAtomic writes data to a temp file next to path, syncs it and renames
+// it over path, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
 	if err != nil {
 		return err
 	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
 
-	err = os.WriteFile(path, writer.Bytes(), 0644)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer d.Close()
+	return d.Sync()
+}
+
+// -------- Persistence --------
+
+// persistState writes a full snapshot of the in-memory state to the store.
+// Only the copy is taken under the lock, the write itself does not block requests.
+func persistState() error {
+	stateMu.RLock()
+	snapshot := cloneState(state)
+	stateMu.RUnlock()
+	return dataStore.SaveState(snapshot)
+}
+
+// cloneState deep copies st, callers must hold stateMu.
+func cloneState(st *InMemoryState) *InMemoryState {
+	out := &InMemoryState{
+		Users:      make(map[string]*UserState, len(st.Users)),
+		JournalSeq: st.JournalSeq,
+		Revealed:   make(map[string]bool, len(st.Revealed)),
+		Unfrozen:   st.Unfrozen,
+
+		Announcements:  append([]Announcement(nil), st.Announcements...),
+		Clarifications: append([]Clarification(nil), st.Clarifications...),
+	}
+	for username := range st.Revealed {
+		out.Revealed[username] = true
+	}
+	for username, us := range st.Users {
+		usCopy := *us
+		usCopy.PerQuestion = make(map[int]*UserQuestionState, len(us.PerQuestion))
+		for questionID, qs := range us.PerQuestion {
+			qsCopy := *qs
+			qsCopy.AttemptHistory = append(AttemptRecords(nil), qs.AttemptHistory...)
+			qsCopy.PromptHistory = append(PromptRecords(nil), qs.PromptHistory...)
+			qsCopy.HintReveals = append([]HintReveal(nil), qs.HintReveals...)
+			qsCopy.RateLimits = append([]RateLimitRecord(nil), qs.RateLimits...)
+			usCopy.PerQuestion[questionID] = &qsCopy
+		}
+		out.Users[username] = &usCopy
+	}
+	return out
 }
 
 func ensureUserState(username string) *UserState {
@@ -100,20 +210,58 @@ func ensureUserState(username string) *UserState {
 			PerQuestion: map[int]*UserQuestionState{},
 		}
 		state.Users[username] = us
+		markStateDirty()
+		scoreboardChanged()
 	}
 	return us
 }
 
-func LoadData() {
-	// Initialize stores and load data files
-	if err := loadUsersFromFile(usersFilePath); err != nil {
+// userStateFor is ensureUserState for contestants. Organisers stay off the
+// scoreboard, so looking around does not create a state for them; they get
+// an empty, unsaved one until they record something.
+func userStateFor(username, role string) *UserState {
+	if role != roleAdmin {
+		return ensureUserState(username)
+	}
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	if us, ok := state.Users[username]; ok {
+		return us
+	}
+	return &UserState{Username: username, PerQuestion: map[int]*UserQuestionState{}}
+}
+
+func LoadData(cfg *Config) {
+	answerNormalization = defaultNormalizationOptions().merge(cfg.Normalization)
+	contestStart = cfg.Schedule.StartAt
+
+	// Initialize stores and load data
+	store, err := newStore(cfg)
+	if err != nil {
+		log.Fatalf("failed to open %s store: %v", cfg.Storage, err)
+	}
+	dataStore = store
+
+	users, err := store.LoadUsers()
+	if err != nil {
+		log.Fatalf("failed to load users: %v", err)
+	}
+	if err := setUsers(users, cfg.AllowPlaintextPasswords); err != nil {
 		log.Fatalf("failed to load users: %v", err)
 	}
-	if err := loadQuestionsFromFile(questionsFilePath); err != nil {
+	questions, err := store.LoadQuestions()
+	if err != nil {
 		log.Fatalf("failed to load questions: %v", err)
 	}
-	// Load persisted state if present
-	if err := loadStateFromFile(persistenceStateAbsPath); err != nil {
-		log.Printf("no existing state to load: %v", err)
+	if err := setQuestionList(questions); err != nil {
+		log.Fatalf("failed to load questions: %v", err)
 	}
+	// a damaged state must never be replaced by an empty one
+	loaded, err := store.LoadState()
+	if err != nil {
+		log.Fatalf("failed to load state: %v", err)
+	}
+	stateMu.Lock()
+	state = loaded
+	stateMu.Unlock()
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------- Question gating --------
+
+// A question is locked until every question in its Prerequisites is solved.
+// A linear story lists the previous question, branches list several.
+const (
+	questionLocked   = "locked"
+	questionUnlocked = "unlocked"
+	questionSolved   = "solved"
+)
+
+var errInvalidQuestions = errors.New("invalid questions")
+
+// validatePrerequisites checks that prerequisites name existing questions and
+// form a DAG, so no question can become impossible to unlock.
+func validatePrerequisites(questions map[int]Question) error {
+	for _, q := range questions {
+		for _, id := range q.Prerequisites {
+			if id == q.ID {
+				return fmt.Errorf("question %d lists itself as a prerequisite", q.ID)
+			}
+			if _, ok := questions[id]; !ok {
+				return fmt.Errorf("question %d: unknown prerequisite %d", q.ID, id)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	marks := make(map[int]int, len(questions))
+	var visit func(id int) error
+	visit = func(id int) error {
+		switch marks[id] {
+		case visiting:
+			return fmt.Errorf("question %d: prerequisites form a cycle", id)
+		case done:
+			return nil
+		}
+		marks[id] = visiting
+		for _, pre := range questions[id].Prerequisites {
+			if err := visit(pre); err != nil {
+				return err
+			}
+		}
+		marks[id] = done
+		return nil
+	}
+	for _, q := range sortedQuestions(questions) {
+		if err := visit(q.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prerequisitesMet reports whether us solved everything q depends on. Disabled
+// prerequisites count as met so a pulled question does not block the story.
+// Caller holds stateMu.
+func prerequisitesMet(us *UserState, q Question) bool {
+	for _, id := range q.Prerequisites {
+		pre, ok := getQuestion(id)
+		if !ok || pre.Disabled {
+			continue
+		}
+		qs, ok := us.PerQuestion[id]
+		if !ok || !qs.AttemptHistory.Solved() {
+			return false
+		}
+	}
+	return true
+}
+
+// isQuestionLocked is prerequisitesMet for handlers, organisers are never locked out.
+func isQuestionLocked(role string, us *UserState, q Question) bool {
+	if role == roleAdmin {
+		return false
+	}
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	return !prerequisitesMet(us, q)
+}
+
+// firstOpenQuestion returns the lowest enabled question us has not solved and
+// may work on, every unsolved one counts as open for organisers.
+func firstOpenQuestion(role string, us *UserState) (int, bool) {
+	questions := sortedQuestions(snapshotQuestions())
+
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	for _, q := range questions {
+		if q.Disabled {
+			continue
+		}
+		if qs, ok := us.PerQuestion[q.ID]; ok && qs.AttemptHistory.Solved() {
+			continue
+		}
+		if role == roleAdmin || prerequisitesMet(us, q) {
+			return q.ID, true
+		}
+	}
+	return 0, false
+}
+
+type questionStatus struct {
+	ID            int    `json:"id"`
+	Status        string `json:"status"`
+	Prerequisites []int  `json:"prerequisites,omitempty"`
+	Hints         int    `json:"hints,omitempty"`
+}
+
+type questionsStatusResponse struct {
+	Questions []questionStatus `json:"questions"`
+}
+
+// questionsStatusHandler lists the enabled questions with their state for the current user.
+func questionsStatusHandler(c *gin.Context) {
+	value, ok := c.Get(claimsKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "unauthorized"})
+		return
+	}
+	us := userStateFor(value.(*Claims).Username, requestRole(c))
+
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
+	list := []questionStatus{}
+	for _, q := range sortedQuestions(snapshotQuestions()) {
+		if q.Disabled {
+			continue
+		}
+		status := questionLocked
+		if qs, ok := us.PerQuestion[q.ID]; ok && qs.AttemptHistory.Solved() {
+			status = questionSolved
+		} else if prerequisitesMet(us, q) {
+			status = questionUnlocked
+		}
+		list = append(list, questionStatus{ID: q.ID, Status: status, Prerequisites: q.Prerequisites, Hints: len(q.Hints)})
+	}
+
+	c.JSON(http.StatusOK, questionsStatusResponse{Questions: list})
+}
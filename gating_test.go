@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidatePrerequisites(t *testing.T) {
+	tests := []struct {
+		name          string
+		prerequisites map[int][]int // question id -> its prerequisites
+		wantErr       string
+	}{
+		{"none", map[int][]int{1: nil, 2: nil}, ""},
+		{"linear", map[int][]int{1: nil, 2: {1}, 3: {2}}, ""},
+		{"diamond", map[int][]int{1: nil, 2: {1}, 3: {1}, 4: {2, 3}}, ""},
+		{"self", map[int][]int{1: nil, 2: {2}}, "question 2 lists itself"},
+		{"unknown", map[int][]int{1: nil, 2: {9}}, "question 2: unknown prerequisite 9"},
+		{"two cycle", map[int][]int{1: {2}, 2: {1}}, "form a cycle"},
+		{"long cycle", map[int][]int{1: nil, 2: {1, 4}, 3: {2}, 4: {3}}, "form a cycle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			questions := map[int]Question{}
+			for id, pre := range tt.prerequisites {
+				questions[id] = Question{ID: id, Answer: "x", Prerequisites: pre}
+			}
+			err := validatePrerequisites(questions)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrerequisitesMet(t *testing.T) {
+	setupHandlerTest(t, map[int]Question{
+		1: {ID: 1, Answer: "x"},
+		2: {ID: 2, Answer: "y", Disabled: true},
+		3: {ID: 3, Answer: "z", Prerequisites: []int{1}},
+		4: {ID: 4, Answer: "w", Prerequisites: []int{1, 2}},
+	})
+	us := ensureUserState("a")
+
+	q1, _ := getQuestion(1)
+	q3, _ := getQuestion(3)
+	q4, _ := getQuestion(4)
+	if prerequisitesMet(us, q3) || prerequisitesMet(us, q4) {
+		t.Error("unlocked before solving question 1")
+	}
+	if status, _ := checkAnswer(us, q1, "x"); status != http.StatusOK {
+		t.Fatal("solve failed")
+	}
+	// the disabled question 2 does not block question 4
+	if !prerequisitesMet(us, q3) || !prerequisitesMet(us, q4) {
+		t.Error("still locked after solving question 1")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------- Hints --------
+
+type revealedHint struct {
+	Index int       `json:"index"`
+	Text  string    `json:"text"`
+	Cost  int       `json:"cost"`
+	At    time.Time `json:"at"`
+}
+
+type hintsResponse struct {
+	Hints     []revealedHint `json:"hints"`
+	Remaining int            `json:"remaining"`
+	// cost of the next hint, omitted when none are left
+	NextCost   *int `json:"next_cost,omitempty"`
+	TotalScore int  `json:"total_score"`
+}
+
+// hintQuestion resolves the :id question for the hint endpoints and checks
+// the user may see it. It writes the error response and returns false otherwise.
+func hintQuestion(c *gin.Context) (*UserState, Question, bool) {
+	value, ok := c.Get(claimsKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "unauthorized"})
+		return nil, Question{}, false
+	}
+	claims := value.(*Claims)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid question id"})
+		return nil, Question{}, false
+	}
+	q, ok := getQuestion(id)
+	if !ok {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "unknown question"})
+		return nil, Question{}, false
+	}
+	if q.Disabled {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "question is disabled"})
+		return nil, Question{}, false
+	}
+
+	us := userStateFor(claims.Username, requestRole(c))
+	if isQuestionLocked(requestRole(c), us, q) {
+		c.JSON(http.StatusForbidden, baseResponse{OK: false, Description: "question is locked"})
+		return nil, Question{}, false
+	}
+	return us, q, true
+}
+
+// buildHintsResponse lists the hints us revealed on q. Caller holds stateMu.
+func buildHintsResponse(us *UserState, q Question) hintsResponse {
+	resp := hintsResponse{Hints: []revealedHint{}, TotalScore: us.TotalScore}
+	revealed := 0
+	if qs, ok := us.PerQuestion[q.ID]; ok {
+		revealed = len(qs.HintReveals)
+		for _, reveal := range qs.HintReveals {
+			h := revealedHint{Index: reveal.Index, Cost: reveal.Cost, At: reveal.At}
+			if reveal.Index < len(q.Hints) {
+				h.Text = q.Hints[reveal.Index].Text
+			}
+			resp.Hints = append(resp.Hints, h)
+		}
+	}
+	resp.Remaining = max(len(q.Hints)-revealed, 0)
+	if resp.Remaining > 0 {
+		cost := q.Hints[revealed].Cost
+		resp.NextCost = &cost
+	}
+	return resp
+}
+
+// hintsHandler returns the hints already revealed for a question.
+func hintsHandler(c *gin.Context) {
+	us, q, ok := hintQuestion(c)
+	if !ok {
+		return
+	}
+
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	c.JSON(http.StatusOK, buildHintsResponse(us, q))
+}
+
+// revealHintHandler reveals the next hint of a question and charges its cost.
+// A team needs the points to pay for it, the zero floor of the total would
+// make hints free before the first solve otherwise.
+func revealHintHandler(c *gin.Context) {
+	us, q, ok := hintQuestion(c)
+	if !ok {
+		return
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	next := 0
+	if qs, ok := us.PerQuestion[q.ID]; ok {
+		next = len(qs.HintReveals)
+	}
+	if next >= len(q.Hints) {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "no more hints"})
+		return
+	}
+
+	cost := q.Hints[next].Cost
+	if us.TotalScore < cost && requestRole(c) != roleAdmin {
+		c.JSON(http.StatusForbidden, baseResponse{OK: false, Description: "not enough points for this hint"})
+		return
+	}
+	err := recordEvent(stateEvent{
+		Type:               eventHint,
+		Username:           us.Username,
+		QuestionID:         q.ID,
+		Hint:               &HintReveal{Index: next, Cost: cost, At: time.Now()},
+		TotalScore:         applyScoreDelta(us.TotalScore, -cost),
+		LastSolvedQuestion: us.LastSolvedQuestion,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to record hint"})
+		return
+	}
+
+	// the stored state, us may be an organiser's unsaved one
+	c.JSON(http.StatusOK, buildHintsResponse(state.Users[us.Username], q))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveHint runs handler for username on question id.
+func serveHint(handler gin.HandlerFunc, username, id string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/questions/"+id+"/hints", nil)
+	c.Params = gin.Params{{Key: "id", Value: id}}
+	c.Set(claimsKey, &Claims{Username: username})
+	handler(c)
+	return w
+}
+
+func hintQuestions() map[int]Question {
+	hints := []Hint{{Text: "first", Cost: 10}, {Text: "second", Cost: 20}}
+	return map[int]Question{
+		1: {ID: 1, Answer: "x", Score: 100},
+		2: {ID: 2, Answer: "y", Score: 50, Hints: hints},
+		3: {ID: 3, Answer: "z", Hints: hints, Prerequisites: []int{2}},
+	}
+}
+
+func TestRevealHintHandler(t *testing.T) {
+	store := setupHandlerTest(t, hintQuestions())
+	if status, _ := checkAnswer(ensureUserState("a"), hintQuestions()[1], "x"); status != http.StatusOK {
+		t.Fatal("solve failed")
+	}
+
+	tests := []struct {
+		name      string
+		id        string
+		wantCode  int
+		wantTexts int // hints revealed after the request
+		wantTotal int
+	}{
+		{"first hint", "2", http.StatusOK, 1, 90},
+		{"second hint", "2", http.StatusOK, 2, 70},
+		{"none left", "2", http.StatusBadRequest, 2, 70},
+		{"locked question", "3", http.StatusForbidden, 0, 70},
+		{"unknown question", "9", http.StatusBadRequest, 0, 70},
+	}
+	for _, tt := range tests {
+		w := serveHint(revealHintHandler, "a", tt.id)
+		if w.Code != tt.wantCode {
+			t.Fatalf("%s: status %d %s, want %d", tt.name, w.Code, w.Body.String(), tt.wantCode)
+		}
+		if got := state.Users["a"].TotalScore; got != tt.wantTotal {
+			t.Errorf("%s: total %d, want %d", tt.name, got, tt.wantTotal)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var resp hintsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Hints) != tt.wantTexts || resp.TotalScore != tt.wantTotal {
+			t.Errorf("%s: %d hints, total %d; want %d, %d", tt.name, len(resp.Hints), resp.TotalScore, tt.wantTexts, tt.wantTotal)
+		}
+		// revealed in order, each charged its own cost
+		for i, h := range resp.Hints {
+			want := hintQuestions()[2].Hints[i]
+			if h.Index != i || h.Text != want.Text || h.Cost != want.Cost {
+				t.Errorf("%s: hint %d = %+v, want %+v", tt.name, i, h, want)
+			}
+		}
+	}
+	// the solve and two reveals
+	if len(store.events) != 3 {
+		t.Errorf("recorded %d events, want 3", len(store.events))
+	}
+}
+
+func TestRevealHintWithoutPoints(t *testing.T) {
+	store := setupHandlerTest(t, hintQuestions())
+
+	w := serveHint(revealHintHandler, "a", "2")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("reveal at 0 points = %d %s, want 403", w.Code, w.Body.String())
+	}
+	if len(store.events) != 0 {
+		t.Errorf("recorded %d events, want none", len(store.events))
+	}
+	if qs := state.Users["a"].PerQuestion[2]; qs != nil && len(qs.HintReveals) != 0 {
+		t.Errorf("hint revealed for free: %+v", qs.HintReveals)
+	}
+
+	// free hints need no points
+	questions := hintQuestions()
+	q := questions[2]
+	q.Hints = []Hint{{Text: "free"}}
+	questions[2] = q
+	setQuestions(questions)
+	if w := serveHint(revealHintHandler, "a", "2"); w.Code != http.StatusOK {
+		t.Errorf("free hint = %d %s, want 200", w.Code, w.Body.String())
+	}
+}
+
+func TestReplayScoresChargesHints(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	users := map[string]*UserState{
+		"a": {Username: "a", TotalScore: 70, PerQuestion: map[int]*UserQuestionState{
+			1: {AttemptHistory: AttemptRecords{{QuestionID: 1, Answer: "x", Correct: true, Score: 100, At: start}}},
+			2: {
+				AttemptHistory: AttemptRecords{{QuestionID: 2, Answer: "y", Correct: true, Score: 50, At: start.Add(3 * time.Minute)}},
+				// charged what they cost then, even though the question's hints changed since
+				HintReveals: []HintReveal{{Index: 0, Cost: 10, At: start.Add(time.Minute)}, {Index: 1, Cost: 20, At: start.Add(2 * time.Minute)}},
+			},
+		}},
+	}
+	results := replayScores(users, map[int]Question{
+		1: {ID: 1, Answer: "x", Score: 100},
+		2: {ID: 2, Answer: "y", Score: 50, Hints: []Hint{{Cost: 99}, {Cost: 99}}},
+	})
+	if got := results["a"].TotalScore; got != 120 {
+		t.Errorf("replayed total = %d, want 100 - 10 - 20 + 50 = 120", got)
+	}
+}
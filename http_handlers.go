@@ -1,9 +1,9 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,17 +13,14 @@ import (
 // -------- HTTP handlers --------
 
 // CORS middleware to handle cross-origin requests
-func CORSMiddleware() gin.HandlerFunc {
+func CORSMiddleware(cfg *Config) gin.HandlerFunc {
+	// Allow specific origins for credentials
+	allowedOrigins := cfg.AllowedOrigins
+	allowHeaders := "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Cookie, Last-Event-ID, " + cfg.JWTCookieName
+
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
-		
-		// Allow specific origins for credentials
-		allowedOrigins := []string{
-			"https://hafkhan.vercel.app",
-			"http://localhost:3000", // for local development
-			"http://localhost:5173", // for Vite dev server
-		}
-		
+
 		// Check if origin is allowed
 		allowed := false
 		for _, allowedOrigin := range allowedOrigins {
@@ -32,7 +29,7 @@ func CORSMiddleware() gin.HandlerFunc {
 				break
 			}
 		}
-		
+
 		// When using credentials, we must specify the exact origin, not "*"
 		if allowed {
 			c.Header("Access-Control-Allow-Origin", origin)
@@ -42,8 +39,8 @@ func CORSMiddleware() gin.HandlerFunc {
 			c.Header("Access-Control-Allow-Origin", "*")
 			// Don't set Access-Control-Allow-Credentials for wildcard origins
 		}
-		
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Cookie, Quiz-Token")
+
+		c.Header("Access-Control-Allow-Headers", allowHeaders)
 		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -65,93 +62,182 @@ type baseResponse struct {
 	Description string `json:"description"`
 }
 
-func loginHandler(c *gin.Context) {
-	var req loginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
-		return
-	}
-	user, ok := usersByUsername[req.Username]
-	if !ok || user.Password != req.Password {
-		c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "invalid credentials"})
-		return
-	}
+func loginHandler(cfg *Config, guard *loginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req loginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
+			return
+		}
 
-	ensureUserState(user.Username)
+		now := time.Now()
+		ip := c.ClientIP()
+		user, ok := usersByUsername[req.Username]
+		if wait := guard.Reserve(req.Username, ip, ok, now); wait > 0 {
+			seconds := secondsUntil(now, now.Add(wait))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, baseResponse{OK: false, Description: "too many failed logins, try again later"})
+			return
+		}
 
-	token, exp, err := generateJWT(user.Username)
-	if err != nil {
-		log.Printf("jwt error: %v", err)
-		c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to generate token"})
-		return
-	}
+		if !ok {
+			burnPasswordCheck(req.Password)
+		}
+		if !ok || !verifyPassword(user.Password, req.Password, cfg.AllowPlaintextPasswords) {
+			guard.Fail(req.Username, ip, now)
+			c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "invalid credentials"})
+			return
+		}
+		guard.Succeed(user.Username, ip, now)
 
-	// Determine if we're running on HTTPS
-	isHTTPS := c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https"
-	
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     jwtCookieName,
-		Value:    token,
-		HttpOnly: true,
-		Secure:   isHTTPS, // Set based on actual protocol
-		SameSite: http.SameSiteNoneMode, // Allow cross-site cookies
-		Path:     "/",
-		Expires:  exp,
-	})
+		// organisers do not take part, keep them off the scoreboard
+		if !user.IsAdmin() {
+			ensureUserState(user.Username)
+		}
 
-	c.JSON(http.StatusOK, baseResponse{OK: true, Description: token})
+		token, exp, err := generateJWT(cfg, user)
+		if err != nil {
+			log.Printf("jwt error: %v", err)
+			c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to generate token"})
+			return
+		}
+
+		// Determine if we're running on HTTPS
+		isHTTPS := c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https"
+
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     cfg.JWTCookieName,
+			Value:    token,
+			HttpOnly: true,
+			Secure:   isHTTPS,               // Set based on actual protocol
+			SameSite: http.SameSiteNoneMode, // Allow cross-site cookies
+			Path:     "/",
+			Expires:  exp,
+		})
+
+		c.JSON(http.StatusOK, baseResponse{OK: true, Description: token})
+	}
 }
 
 // Middleware: validate JWT from cookie and put claims in headers for downstream
-func JWTAuthMiddleware() gin.HandlerFunc {
+func JWTAuthMiddleware(cfg *Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		cookie := c.Request.Header.Get(jwtCookieName)
+		cookie := c.Request.Header.Get(cfg.JWTCookieName)
 		if cookie == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "missing auth token"})
 			return
 		}
-		claims, err := parseJWT(cookie)
+		claims, err := parseJWT(cfg, cookie)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "invalid auth token"})
 			return
 		}
 
+		// the role comes from users.json, not the token, so a demoted
+		// organiser loses their rights without waiting for the token to expire
+		user, ok := usersByUsername[claims.Username]
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "unknown user"})
+			return
+		}
+
 		c.Set(claimsKey, claims)
+		c.Set(roleKey, user.GetRole())
 		c.Next()
 	}
 }
 
-func submitAnswerHandler(c *gin.Context) {
+// requestRole is the role JWTAuthMiddleware resolved for the request.
+func requestRole(c *gin.Context) string {
+	return c.GetString(roleKey)
+}
 
-	value, ok := c.Get(claimsKey)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "unauthorized"})
-		return
+// Middleware: allow only users with one of the given roles, must run after JWTAuthMiddleware
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current := requestRole(c)
+		if current == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "unauthorized"})
+			return
+		}
+		for _, role := range roles {
+			if current == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, baseResponse{OK: false, Description: "forbidden"})
 	}
-	claims := value.(*Claims)
+}
 
-	var req submitAnswerRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
-		return
+func submitAnswerHandler(cfg *Config) gin.HandlerFunc {
+	var limiter *rateLimiter
+	if cfg.SubmitBurst > 0 {
+		limiter = newRateLimiter(cfg.SubmitBurst, cfg.SubmitInterval)
 	}
 
-	q, ok := questionsByID[req.QuestionID]
-	if !ok {
-		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "unknown question"})
-		return
-	}
+	return func(c *gin.Context) {
+
+		value, ok := c.Get(claimsKey)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "unauthorized"})
+			return
+		}
+		claims := value.(*Claims)
 
-	us := ensureUserState(claims.Username)
+		var req submitAnswerRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
+			return
+		}
+
+		q, ok := getQuestion(req.QuestionID)
+		if !ok {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "unknown question"})
+			return
+		}
+		if q.Disabled {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "question is disabled"})
+			return
+		}
+
+		us := userStateFor(claims.Username, requestRole(c))
+		if isQuestionLocked(requestRole(c), us, q) {
+			c.JSON(http.StatusForbidden, baseResponse{OK: false, Description: "question is locked"})
+			return
+		}
+		if limiter != nil && requestRole(c) != roleAdmin {
+			now := time.Now()
+			ok, retryAfter, first := limiter.Allow(submitKey{claims.Username, q.ID}, now)
+			if !ok {
+				seconds := secondsUntil(now, now.Add(retryAfter))
+				if first {
+					recordRateLimit(us, q.ID, now, seconds)
+				}
+				c.Header("Retry-After", strconv.Itoa(seconds))
+				c.JSON(http.StatusTooManyRequests, submitAnswerResponse{OK: false, Description: "too many submissions, slow down", RetryAfterSeconds: seconds})
+				return
+			}
+		}
+
+		status, response := checkAnswer(us, q, req.Answer)
+		if status == http.StatusTooManyRequests {
+			c.Header("Retry-After", strconv.Itoa(response.RetryAfterSeconds))
+		}
 
-	status, response := checkAnswer(us, q, req.Answer)
-	persistStateToFile(persistenceStateAbsPath)
+		c.JSON(status, response)
+	}
+}
 
-	c.JSON(status, response)
+type submitAnswerResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	// set while the question is locked after too many wrong answers
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
 }
 
-func checkAnswer(us *UserState, q Question, answer string) (int, baseResponse) {
+func checkAnswer(us *UserState, q Question, answer string) (int, submitAnswerResponse) {
 	stateMu.Lock()
 	defer stateMu.Unlock()
 
@@ -162,36 +248,48 @@ func checkAnswer(us *UserState, q Question, answer string) (int, baseResponse) {
 		us.PerQuestion[q.ID] = qs
 	}
 
-	// If already solved, do not award points again
-	if qs.AttemptHistory.Solved() {
-		qs.AttemptHistory = append(qs.AttemptHistory, AttemptRecord{QuestionID: q.ID, Answer: answer, Correct: true, At: time.Now()})
-		return http.StatusOK, baseResponse{true, "already solved"}
+	now := time.Now()
+	if until := q.lockedUntil(qs.AttemptHistory); now.Before(until) {
+		return http.StatusTooManyRequests, submitAnswerResponse{false, "too many wrong answers, try again later", secondsUntil(now, until)}
 	}
 
-	fmt.Println(us.Username)
-	correct := normalize(answer) == normalize(q.GetCorrectAnswer(us.Username))
-	qs.AttemptHistory = append(qs.AttemptHistory, AttemptRecord{QuestionID: q.ID, Answer: answer, Correct: correct, At: time.Now()})
-
-	if correct {
-		us.TotalScore += q.Score
-		if q.ID > us.LastSolvedQuestion {
-			us.LastSolvedQuestion = q.ID
-		}
-
-		return http.StatusOK, baseResponse{true, "correct answer"}
+	outcome := evaluateAttempt(q, us.Username, answer, qs.AttemptHistory, solveContext{At: now, Solves: countSolves(state.Users, q.ID)})
+	entry := stateEvent{
+		Type:       eventAttempt,
+		Username:   us.Username,
+		QuestionID: q.ID,
+		Attempt: &AttemptRecord{
+			QuestionID: q.ID,
+			Answer:     answer,
+			Correct:    outcome.Correct,
+			At:         now,
+			Score:      outcome.ScoreDelta,
+		},
+		TotalScore:         applyScoreDelta(us.TotalScore, outcome.ScoreDelta),
+		LastSolvedQuestion: us.LastSolvedQuestion,
 	}
-
-	//handle penalty
-	wrongAttempts := qs.AttemptHistory.CountByCorrectnessState(false)
-	shouldGetPenalty := wrongAttempts%q.PenaltyTryCount == 0
-	if shouldGetPenalty {
-		us.TotalScore = max(us.TotalScore-q.Penalty, 0)
+	if outcome.Correct && !outcome.AlreadySolved && q.ID > us.LastSolvedQuestion {
+		entry.LastSolvedQuestion = q.ID
+	}
+	if outcome.Correct && !outcome.AlreadySolved && q.isDynamic() && !usersByUsername[us.Username].IsAdmin() {
+		entry.Adjustments = dynamicAdjustments(state.Users, q)
+	}
+	if err := recordEvent(entry); err != nil {
+		return http.StatusInternalServerError, submitAnswerResponse{OK: false, Description: "failed to record submission"}
 	}
-	return http.StatusOK, baseResponse{false, "wrong answer"}
-}
 
-func normalize(s string) string {
-	return strings.TrimSpace(strings.ToLower(s))
+	if outcome.AlreadySolved {
+		return http.StatusOK, submitAnswerResponse{OK: true, Description: "already solved"}
+	}
+	if outcome.Correct {
+		return http.StatusOK, submitAnswerResponse{OK: true, Description: "correct answer"}
+	}
+	resp := submitAnswerResponse{OK: false, Description: "wrong answer"}
+	// recordEvent appended to the stored state, us may be an organiser's unsaved one
+	if until := q.lockedUntil(state.Users[us.Username].PerQuestion[q.ID].AttemptHistory); now.Before(until) {
+		resp.RetryAfterSeconds = secondsUntil(now, until)
+	}
+	return http.StatusOK, resp
 }
 
 func userHandler(c *gin.Context) {
@@ -207,168 +305,285 @@ func userHandler(c *gin.Context) {
 		return
 	}
 
-	username := claimsData.Username
-	userState := ensureUserState(username)
+	userState := userStateFor(claimsData.Username, requestRole(c))
 
 	c.JSON(http.StatusOK, userState)
 }
 
-func promptHandler(c *gin.Context) {
-	claims, exists := c.Get(claimsKey)
-	if !exists {
-		c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "unauthorized"})
-		return
-	}
+func promptHandler(llm *llmRouter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, exists := c.Get(claimsKey)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "unauthorized"})
+			return
+		}
 
-	claimsData, ok := claims.(*Claims)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "invalid claims"})
-		return
-	}
+		claimsData, ok := claims.(*Claims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, baseResponse{OK: false, Description: "invalid claims"})
+			return
+		}
 
-	var req promptRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
-		return
-	}
+		var req promptRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
+			return
+		}
 
-	// Validate system prompt ID
-	systemPrompt, exists := systemPrompts[req.SystemPromptID]
-	if !exists {
-		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid system prompt ID"})
-		return
-	}
+		// Validate system prompt ID
+		systemPrompt, exists := systemPrompts[req.SystemPromptID]
+		if !exists {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid system prompt ID"})
+			return
+		}
 
-	username := claimsData.Username
-	userState := ensureUserState(username)
+		username := claimsData.Username
+		userState := userStateFor(username, requestRole(c))
 
-	// Get current question (assuming user is working on the last solved question + 1)
-	currentQuestionID := userState.LastSolvedQuestion + 1
-	if currentQuestionID == 0 {
-		currentQuestionID = 1 // Start with question 1
-	}
+		// without a question_id the user is working on their first open question
+		currentQuestionID := req.QuestionID
+		if currentQuestionID == 0 {
+			id, ok := firstOpenQuestion(requestRole(c), userState)
+			if !ok {
+				c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "no open question"})
+				return
+			}
+			currentQuestionID = id
+		}
+		q, ok := getQuestion(currentQuestionID)
+		if !ok {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "unknown question"})
+			return
+		}
+		if q.Disabled {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "question is disabled"})
+			return
+		}
+		if isQuestionLocked(requestRole(c), userState, q) {
+			c.JSON(http.StatusForbidden, baseResponse{OK: false, Description: "question is locked"})
+			return
+		}
 
-	// Ensure per-question state exists
-	stateMu.Lock()
-	qs, exists := userState.PerQuestion[currentQuestionID]
-	if !exists {
-		qs = &UserQuestionState{
-			AttemptHistory: []AttemptRecord{},
-			PromptHistory:  []PromptRecord{},
+		// Build messages with prompt history
+		messages := []chatMessage{
+			{Role: "system", Content: systemPrompt},
 		}
-		userState.PerQuestion[currentQuestionID] = qs
-	}
-	stateMu.Unlock()
 
-	// Build messages with prompt history
-	messages := []avalaiMessage{
-		{Role: "system", Content: systemPrompt},
-	}
+		// Add previous prompt history for this question
+		stateMu.RLock()
+		if qs, ok := userState.PerQuestion[currentQuestionID]; ok {
+			for _, prompt := range qs.PromptHistory {
+				messages = append(messages, chatMessage{
+					Role:    "user",
+					Content: prompt.UserPrompt,
+				})
+			}
+		}
+		stateMu.RUnlock()
 
-	// Add previous prompt history for this question
-	for _, prompt := range qs.PromptHistory {
-		messages = append(messages, avalaiMessage{
+		// Add current user prompt
+		messages = append(messages, chatMessage{
 			Role:    "user",
-			Content: prompt.UserPrompt,
+			Content: req.UserPrompt,
 		})
-	}
 
-	// Add current user prompt
-	messages = append(messages, avalaiMessage{
-		Role:    "user",
-		Content: req.UserPrompt,
-	})
+		if req.Stream {
+			streamPrompt(c, llm.For(req.SystemPromptID), messages, username, currentQuestionID, req)
+			return
+		}
 
-	result, err := callAvalaiApi(messages)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: err.Error()})
-		return
+		result, err := llm.For(req.SystemPromptID).Complete(c.Request.Context(), messages)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: err.Error()})
+			return
+		}
+		// Save prompt history
+		if err := recordPrompt(username, currentQuestionID, req, result); err != nil {
+			c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to record prompt"})
+			return
+		}
+
+		c.JSON(http.StatusOK, promptResponse{Result: result})
 	}
-	// Save prompt history
+}
+
+func recordPrompt(username string, questionID int, req promptRequest, result string) error {
 	stateMu.Lock()
-	qs.PromptHistory = append(qs.PromptHistory, PromptRecord{
-		UserPrompt:     req.UserPrompt,
-		SystemPromptID: req.SystemPromptID,
-		Result:         result,
-		At:             time.Now(),
+	defer stateMu.Unlock()
+	return recordEvent(stateEvent{
+		Type:       eventPrompt,
+		Username:   username,
+		QuestionID: questionID,
+		Prompt: &PromptRecord{
+			UserPrompt:     req.UserPrompt,
+			SystemPromptID: req.SystemPromptID,
+			Result:         result,
+			At:             time.Now(),
+		},
 	})
-	stateMu.Unlock()
-	persistStateToFile(persistenceStateAbsPath)
+}
 
-	c.JSON(http.StatusOK, promptResponse{Result: result})
+type promptToken struct {
+	Text string `json:"text"`
 }
 
-func getUserAllHandler(c *gin.Context) {
-	stateMu.RLock()
-	defer stateMu.RUnlock()
-
-	var usersInfo []UserAllInfo
-
-	// Iterate through all users in the state
-	for username, userState := range state.Users {
-		var solvedQuestions []SolvedQuestion
-
-		// Check each question for this user
-		for questionID, questionState := range userState.PerQuestion {
-			// Check if the question was solved (has at least one correct attempt)
-			if questionState.AttemptHistory.Solved() {
-				// Find the first correct attempt to get the solve time
-				var solvedAt time.Time
-				for _, attempt := range questionState.AttemptHistory {
-					if attempt.Correct {
-						solvedAt = attempt.At
-						break
-					}
-				}
+// streamPrompt forwards the answer to the client as server-sent "token"
+// events and ends with "done" carrying the whole result, or "error". The
+// provider is read to the end even if the client goes away, so the complete
+// result is recorded either way; if the provider fails mid-way the part the
+// contestant already saw is. Errors before the first token are plain JSON
+// responses like without streaming.
+func streamPrompt(c *gin.Context, client LLMClient, messages []chatMessage, username string, questionID int, req promptRequest) {
+	started, clientGone := false, false
+	send := func(msg sseMessage) {
+		if clientGone {
+			return
+		}
+		if !started {
+			startSSE(c)
+			started = true
+		}
+		if writeSSE(c.Writer, msg) != nil {
+			clientGone = true
+			return
+		}
+		c.Writer.Flush()
+	}
 
-				// Get the question score
-				question, exists := questionsByID[questionID]
-				score := 0
-				if exists {
-					score = question.Score
-				}
+	ctx := context.WithoutCancel(c.Request.Context())
+	result, err := streamCompletion(ctx, client, messages, func(token string) {
+		send(newSSEMessage("", "token", promptToken{Text: token}))
+	})
+	if err != nil {
+		if result != "" {
+			// a failure to store is logged by recordEvent, the contestant gets the stream error
+			log.Printf("prompt stream of %s failed after %d bytes, recording the partial result", username, len(result))
+			recordPrompt(username, questionID, req, result)
+		}
+		if !started {
+			c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: err.Error()})
+			return
+		}
+		send(newSSEMessage("", "error", baseResponse{OK: false, Description: err.Error()}))
+		return
+	}
+	if clientGone || c.Request.Context().Err() != nil {
+		log.Printf("prompt stream of %s closed by the client, recording the full result", username)
+	}
 
-				solvedQuestions = append(solvedQuestions, SolvedQuestion{
-					QuestionID: questionID,
-					SolvedAt:   solvedAt,
-					Score:      score,
-				})
-			}
+	if err := recordPrompt(username, questionID, req, result); err != nil {
+		if !started {
+			c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to record prompt"})
+			return
 		}
+		send(newSSEMessage("", "error", baseResponse{OK: false, Description: "failed to record prompt"}))
+		return
+	}
+	send(newSSEMessage("", "done", promptResponse{Result: result}))
+}
 
-		usersInfo = append(usersInfo, UserAllInfo{
-			Username:        username,
-			TotalScore:      userState.TotalScore,
-			SolvedQuestions: solvedQuestions,
-		})
+type healthResponse struct {
+	OK          bool              `json:"ok"`
+	Persistence persistenceHealth `json:"persistence"`
+}
+
+// healthHandler needs no login, so it does not repeat the storage error: it
+// can name files and tables, Flush already logged it.
+func healthHandler(c *gin.Context) {
+	health := persister.Health()
+	status := http.StatusOK
+	if !health.OK {
+		status = http.StatusServiceUnavailable
+		health.LastError = "failed to save state, see the server log"
 	}
+	c.JSON(status, healthResponse{OK: health.OK, Persistence: health})
+}
 
-	c.JSON(http.StatusOK, GetAllUsersResponse{Users: usersInfo})
+// getUserAllHandler returns the ranked scoreboard, ?offset= and ?limit= page
+// it. While the scoreboard is frozen contestants see it as of the freeze,
+// organisers always see live results.
+func getUserAllHandler(c *gin.Context) {
+	offset, limit, ok := pageParams(c.Query("offset"), c.Query("limit"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid offset or limit"})
+		return
+	}
+	users, frozen := scoreboard.Board(requestRole(c))
+	c.JSON(http.StatusOK, GetAllUsersResponse{Users: paginate(users, offset, limit), Total: len(users), Frozen: frozen})
 }
 
-func RegisterHandlers() *http.Server {
+func RegisterHandlers(cfg *Config) *http.Server {
 	r := gin.Default()
+	// validated with the config; gin trusts every peer unless told otherwise,
+	// nil makes ClientIP the peer address
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("trusted_proxies: %v", err)
+	}
 
 	// Apply CORS middleware to all routes
-	r.Use(CORSMiddleware())
+	r.Use(CORSMiddleware(cfg))
+
+	logins := newLoginGuard(cfg)
+	scoreboard = newScoreboardHub(cfg)
+	scoreboard.Start()
+	userEvents = newUserEventHub(cfg)
+	userEvents.Start()
 
 	// Routes
-	r.POST("/login", loginHandler)
+	r.POST("/login", loginHandler(cfg, logins))
+	r.GET("/health", healthHandler)
+	r.GET("/competition", competitionStatusHandler(cfg))
+	r.GET("/announcements", announcementsHandler)
+	r.GET("/ws", cookieTokenFallback(cfg), JWTAuthMiddleware(cfg), userEventsHandler(cfg))
 
 	auth := r.Group("/")
-	auth.Use(JWTAuthMiddleware())
+	auth.Use(JWTAuthMiddleware(cfg))
 	{
-		auth.POST("/submit_answer", submitAnswerHandler)
+		auth.POST("/submit_answer", RequireCompetitionRunning(cfg), submitAnswerHandler(cfg))
 		auth.GET("/user", userHandler)
-		auth.POST("/prompt", promptHandler)
+		auth.GET("/questions", questionsStatusHandler)
+		auth.GET("/questions/:id/hints", hintsHandler)
+		auth.POST("/questions/:id/hints", RequireCompetitionRunning(cfg), revealHintHandler)
+		auth.POST("/prompt", RequireCompetitionRunning(cfg), promptHandler(newLLMRouter(cfg)))
 		auth.GET("/users", getUserAllHandler)
+		auth.GET("/scoreboard/stream", scoreboardStreamHandler)
+		auth.GET("/clarifications", clarificationsHandler)
+		auth.POST("/clarifications", createClarificationHandler)
+	}
+
+	admin := r.Group("/admin")
+	admin.Use(JWTAuthMiddleware(cfg), RequireRole(roleAdmin))
+	{
+		admin.GET("/users", adminListUsersHandler)
+		admin.GET("/logins", adminLoginsHandler(logins))
+		admin.POST("/users/:username/unlock", adminUnlockUserHandler(logins))
+
+		admin.GET("/questions", adminListQuestionsHandler)
+		admin.POST("/questions", adminCreateQuestionHandler)
+		admin.PUT("/questions/:id", adminUpdateQuestionHandler)
+		admin.POST("/questions/:id/disable", adminSetQuestionDisabledHandler(true))
+		admin.POST("/questions/:id/enable", adminSetQuestionDisabledHandler(false))
+		admin.POST("/questions/reload", adminReloadQuestionsHandler)
+
+		admin.POST("/announcements", adminCreateAnnouncementHandler)
+		admin.GET("/clarifications", adminClarificationsHandler)
+		admin.POST("/clarifications/:id/reply", adminReplyClarificationHandler)
+
+		admin.POST("/scoreboard/reveal", adminRevealHandler(cfg))
+		admin.POST("/scoreboard/unfreeze", adminUnfreezeHandler)
+
+		admin.GET("/rescore", adminRescorePreviewHandler)
+		admin.POST("/rescore", adminRescoreApplyHandler)
 	}
 
 	srv := &http.Server{
-		Addr:              serverAddress,
+		Addr:              cfg.ServerAddress,
 		Handler:           r,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
+	// open scoreboard streams would otherwise hold Shutdown until its deadline
+	srv.RegisterOnShutdown(scoreboard.Close)
+	srv.RegisterOnShutdown(userEvents.Close)
 
 	return srv
 }
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memStore keeps the appended events in memory, the rest is not needed by
+// handler tests.
+type memStore struct {
+	events    []stateEvent
+	appendErr error
+}
+
+func (s *memStore) LoadUsers() ([]User, error)               { return nil, nil }
+func (s *memStore) LoadQuestions() ([]Question, error)       { return nil, nil }
+func (s *memStore) SaveQuestions(questions []Question) error { return nil }
+func (s *memStore) LoadState() (*InMemoryState, error)       { return newTestState(0), nil }
+func (s *memStore) SaveState(st *InMemoryState) error        { return nil }
+func (s *memStore) Close() error                             { return nil }
+
+func (s *memStore) AppendEvent(e stateEvent) error {
+	if s.appendErr != nil {
+		return s.appendErr
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+// setupHandlerTest swaps in an empty state, questions and a memStore.
+func setupHandlerTest(t *testing.T, questions map[int]Question) *memStore {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	oldState, oldStore, oldQuestions := state, dataStore, snapshotQuestions()
+	store := &memStore{}
+	state, dataStore = newTestState(0), store
+	setQuestions(questions)
+	t.Cleanup(func() {
+		state, dataStore = oldState, oldStore
+		setQuestions(oldQuestions)
+	})
+	return store
+}
+
+// servePrompt runs promptHandler for username with body and returns the recorder.
+func servePrompt(llm *llmRouter, username string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/prompt", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(claimsKey, &Claims{Username: username})
+	promptHandler(llm)(c)
+	return w
+}
+
+func fakeRouter(t *testing.T, reply string) *llmRouter {
+	t.Helper()
+	cfg := &Config{
+		LLMProviders:       map[string]LLMProviderConfig{"fake": {Type: llmFake, Reply: reply}},
+		DefaultLLMProvider: "fake",
+	}
+	return newLLMRouter(cfg)
+}
+
+func TestPromptHandler(t *testing.T) {
+	questions := map[int]Question{
+		1: {ID: 1, Answer: "x"},
+		2: {ID: 2, Answer: "y", Prerequisites: []int{1}},
+		3: {ID: 3, Answer: "z", Disabled: true},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   int
+		wantBody   string
+		wantRecord bool
+	}{
+		{"answers and records", `{"user_prompt": "hi", "system_prompt_id": 1, "question_id": 1}`, http.StatusOK, `"echo: hi"`, true},
+		{"defaults to the next question", `{"user_prompt": "hi", "system_prompt_id": 1}`, http.StatusOK, `"echo: hi"`, true},
+		{"invalid body", `{"user_prompt": `, http.StatusBadRequest, "invalid request body", false},
+		{"unknown system prompt", `{"user_prompt": "hi", "system_prompt_id": 99}`, http.StatusBadRequest, "invalid system prompt ID", false},
+		{"unknown question", `{"user_prompt": "hi", "system_prompt_id": 1, "question_id": 99}`, http.StatusBadRequest, "unknown question", false},
+		{"disabled question", `{"user_prompt": "hi", "system_prompt_id": 1, "question_id": 3}`, http.StatusBadRequest, "question is disabled", false},
+		{"locked question", `{"user_prompt": "hi", "system_prompt_id": 1, "question_id": 2}`, http.StatusForbidden, "question is locked", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := setupHandlerTest(t, questions)
+			w := servePrompt(fakeRouter(t, ""), "a", tt.body)
+
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("response = %d %s, want %d containing %s", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+			if recorded := len(store.events) == 1; recorded != tt.wantRecord {
+				t.Fatalf("recorded %d events, want recorded %t", len(store.events), tt.wantRecord)
+			}
+			if !tt.wantRecord {
+				return
+			}
+			history := state.Users["a"].PerQuestion[1].PromptHistory
+			if len(history) != 1 || history[0].UserPrompt != "hi" || history[0].Result != "echo: hi" {
+				t.Errorf("prompt history = %+v", history)
+			}
+		})
+	}
+}
+
+// recordingLLM remembers what it was asked.
+type recordingLLM struct {
+	fakeLLMClient
+	messages []chatMessage
+}
+
+func (r *recordingLLM) Complete(ctx context.Context, messages []chatMessage) (string, error) {
+	r.messages = messages
+	return r.fakeLLMClient.Complete(ctx, messages)
+}
+
+func TestPromptHandlerSendsHistory(t *testing.T) {
+	setupHandlerTest(t, map[int]Question{1: {ID: 1, Answer: "x"}})
+	client := &recordingLLM{}
+	llm := &llmRouter{clients: map[string]LLMClient{"fake": client}, defaultProvider: "fake"}
+
+	for _, prompt := range []string{"first", "second"} {
+		if w := servePrompt(llm, "a", `{"user_prompt": "`+prompt+`", "system_prompt_id": 1}`); w.Code != http.StatusOK {
+			t.Fatalf("prompt %q = %d %s", prompt, w.Code, w.Body.String())
+		}
+	}
+	var got []string
+	for _, m := range client.messages {
+		got = append(got, m.Role+":"+m.Content)
+	}
+	want := []string{"system:" + systemPrompts[1], "user:first", "user:second"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+}
+
+func TestPromptHandlerStoreFailure(t *testing.T) {
+	store := setupHandlerTest(t, map[int]Question{1: {ID: 1, Answer: "x"}})
+	store.appendErr = errors.New("disk full")
+
+	w := servePrompt(fakeRouter(t, "ok"), "a", `{"user_prompt": "hi", "system_prompt_id": 1}`)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "failed to record prompt") {
+		t.Errorf("response = %d %s, want 500", w.Code, w.Body.String())
+	}
+	if qs := state.Users["a"].PerQuestion[1]; qs != nil && len(qs.PromptHistory) != 0 {
+		t.Errorf("prompt applied although the store failed: %+v", qs.PromptHistory)
+	}
+}
+
+func TestPromptHandlerStream(t *testing.T) {
+	store := setupHandlerTest(t, map[int]Question{1: {ID: 1, Answer: "x"}})
+	w := servePrompt(fakeRouter(t, "one two three"), "a", `{"user_prompt": "hi", "system_prompt_id": 1, "stream": true}`)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("response = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var events []string
+	var done promptResponse
+	for _, block := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		event, data, _ := strings.Cut(block, "\n")
+		event, data = strings.TrimPrefix(event, "event: "), strings.TrimPrefix(data, "data: ")
+		events = append(events, event)
+		if event == "done" {
+			if err := json.Unmarshal([]byte(data), &done); err != nil {
+				t.Fatalf("decode done: %v", err)
+			}
+		}
+	}
+	if want := "token token token done"; strings.Join(events, " ") != want {
+		t.Errorf("events = %v, want %s", events, want)
+	}
+	if done.Result != "one two three" || len(store.events) != 1 {
+		t.Errorf("done = %q with %d events recorded", done.Result, len(store.events))
+	}
+}
+
+// brokenStreamer sends part of an answer and then fails.
+type brokenStreamer struct{ fakeLLMClient }
+
+func (brokenStreamer) Stream(ctx context.Context, messages []chatMessage, onToken func(string)) (string, error) {
+	onToken("half ")
+	return "half ", errLLMUnavailable
+}
+
+func TestPromptHandlerStreamFailsMidway(t *testing.T) {
+	store := setupHandlerTest(t, map[int]Question{1: {ID: 1, Answer: "x"}})
+	llm := &llmRouter{clients: map[string]LLMClient{"fake": brokenStreamer{}}, defaultProvider: "fake"}
+	w := servePrompt(llm, "a", `{"user_prompt": "hi", "system_prompt_id": 1, "stream": true}`)
+
+	if !strings.Contains(w.Body.String(), "event: error") {
+		t.Errorf("stream = %q, want an error event", w.Body.String())
+	}
+	if len(store.events) != 1 {
+		t.Fatalf("recorded %d events, want the partial result", len(store.events))
+	}
+	if history := state.Users["a"].PerQuestion[1].PromptHistory; len(history) != 1 || history[0].Result != "half " {
+		t.Errorf("prompt history = %+v, want the partial result", history)
+	}
+}
+
+func TestJWTAuthMiddlewareRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oldUsers := usersByUsername
+	t.Cleanup(func() { usersByUsername = oldUsers })
+	usersByUsername = map[string]User{
+		"organiser": {Username: "organiser", Role: roleAdmin},
+		"demoted":   {Username: "demoted"},
+		"promoted":  {Username: "promoted", Role: roleAdmin},
+	}
+	cfg := &Config{JWTSecret: strings.Repeat("s", minJWTSecretLength), JWTCookieName: "Quiz-Token", JWTExpiration: time.Hour}
+
+	r := gin.New()
+	r.GET("/role", JWTAuthMiddleware(cfg), func(c *gin.Context) { c.String(http.StatusOK, requestRole(c)) })
+	r.GET("/admin", JWTAuthMiddleware(cfg), RequireRole(roleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name      string
+		token     User // what the token was issued for
+		wantRole  string
+		wantAdmin int
+	}{
+		{"organiser", User{Username: "organiser", Role: roleAdmin}, roleAdmin, http.StatusOK},
+		{"demoted since login", User{Username: "demoted", Role: roleAdmin}, roleContestant, http.StatusForbidden},
+		{"promoted since login", User{Username: "promoted"}, roleAdmin, http.StatusOK},
+		{"removed since login", User{Username: "removed", Role: roleAdmin}, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := generateJWT(cfg, tt.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			get := func(path string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header.Set(cfg.JWTCookieName, token)
+				r.ServeHTTP(w, req)
+				return w
+			}
+
+			w := get("/role")
+			if tt.wantRole == "" {
+				if w.Code != http.StatusUnauthorized {
+					t.Errorf("/role = %d, want 401", w.Code)
+				}
+			} else if w.Code != http.StatusOK || w.Body.String() != tt.wantRole {
+				t.Errorf("/role = %d %q, want %q", w.Code, w.Body.String(), tt.wantRole)
+			}
+			if w := get("/admin"); w.Code != tt.wantAdmin {
+				t.Errorf("/admin = %d, want %d", w.Code, tt.wantAdmin)
+			}
+		})
+	}
+}
+
+func TestPromptHandlerDefaultQuestion(t *testing.T) {
+	questions := map[int]Question{
+		1: {ID: 1, Answer: "x"},
+		2: {ID: 2, Answer: "y", Prerequisites: []int{1}},
+		3: {ID: 3, Answer: "z"},
+		4: {ID: 4, Answer: "w", Disabled: true},
+	}
+	setupHandlerTest(t, questions)
+	us := ensureUserState("a")
+
+	tests := []struct {
+		solve    int // solved before prompting
+		wantID   int // 0 when no question is open
+		wantCode int
+	}{
+		{0, 1, http.StatusOK},
+		// solved out of order, question 1 is still open
+		{3, 1, http.StatusOK},
+		{1, 2, http.StatusOK},
+		{2, 0, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if tt.solve != 0 {
+			if status, _ := checkAnswer(us, questions[tt.solve], questions[tt.solve].Answer); status != http.StatusOK {
+				t.Fatalf("solving %d failed", tt.solve)
+			}
+		}
+		w := servePrompt(fakeRouter(t, ""), "a", `{"user_prompt": "hi", "system_prompt_id": 1}`)
+		if w.Code != tt.wantCode {
+			t.Fatalf("after solving %d: response %d %s, want %d", tt.solve, w.Code, w.Body.String(), tt.wantCode)
+		}
+		if tt.wantID == 0 {
+			if !strings.Contains(w.Body.String(), "no open question") {
+				t.Errorf("after solving %d: %s, want no open question", tt.solve, w.Body.String())
+			}
+			continue
+		}
+		if qs := state.Users["a"].PerQuestion[tt.wantID]; qs == nil || len(qs.PromptHistory) == 0 {
+			t.Errorf("after solving %d: prompt not recorded on question %d", tt.solve, tt.wantID)
+		}
+	}
+}
+
+func TestHealthHandlerHidesStorageErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oldPersister := persister
+	t.Cleanup(func() { persister = oldPersister })
+	persister = newStatePersister(time.Minute)
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/health", nil)
+		healthHandler(c)
+		return w
+	}
+	if w := serve(); w.Code != http.StatusOK {
+		t.Fatalf("healthy = %d %s", w.Code, w.Body.String())
+	}
+
+	persister.lastErr = errors.New("open /srv/quiz/assets/state.json: permission denied")
+	persister.lastErrAt = time.Now()
+	w := serve()
+	if w.Code != http.StatusServiceUnavailable || strings.Contains(w.Body.String(), "state.json") {
+		t.Errorf("failing = %d %s, want 503 without the error", w.Code, w.Body.String())
+	}
+	var resp healthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.OK || resp.Persistence.LastError == "" || resp.Persistence.LastErrorAt == nil {
+		t.Errorf("response = %+v, want a generic error", resp)
+	}
+}
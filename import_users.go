@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// -------- import-users command --------
+
+type importedCredential struct {
+	Username string
+	Password string
+}
+
+type importedTeam struct {
+	Name string
+	Role string
+}
+
+// runImportUsers reads team names (and an optional role column) from a CSV file, generates a random password
+// for each team, writes the hashed users.json and prints a credentials sheet.
+//
+//	BaleCompetition import-users -csv teams.csv -out ./assets/users.json
+func runImportUsers(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	csvPath := fs.String("csv", "", "CSV file with one team name per row, optional second column is the role")
+	outPath := fs.String("out", defaultConfig().UsersFilePath, "users.json to write")
+	sheetPath := fs.String("sheet", "", "write the credentials sheet as CSV to this file instead of stdout")
+	length := fs.Int("length", 10, "generated password length")
+	force := fs.Bool("force", false, "overwrite an existing users.json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *csvPath == "" {
+		return errors.New("-csv is required")
+	}
+	if *length < 8 {
+		return errors.New("-length must be at least 8")
+	}
+	if _, err := os.Stat(*outPath); err == nil && !*force {
+		return fmt.Errorf("%s already exists, pass -force to overwrite", *outPath)
+	}
+
+	teams, err := readTeams(*csvPath)
+	if err != nil {
+		return err
+	}
+
+	users := make([]User, 0, len(teams))
+	creds := make([]importedCredential, 0, len(teams))
+	for _, team := range teams {
+		password, err := generatePassword(*length)
+		if err != nil {
+			return err
+		}
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+		users = append(users, User{Username: team.Name, Password: hash, Role: team.Role})
+		creds = append(creds, importedCredential{Username: team.Name, Password: password})
+	}
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	// a crash mid-write must not leave the event without users
+	if err := writeFileAtomic(*outPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	if *sheetPath != "" {
+		f, err := os.OpenFile(*sheetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w := csv.NewWriter(f)
+		w.Write([]string{"username", "password"})
+		for _, c := range creds {
+			w.Write([]string{c.Username, c.Password})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "wrote %d users to %s, credentials sheet in %s\n", len(users), *outPath, *sheetPath)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tPASSWORD")
+	for _, c := range creds {
+		fmt.Fprintf(tw, "%s\t%s\n", c.Username, c.Password)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "\nwrote %d users to %s\n", len(users), *outPath)
+	return nil
+}
+
+// readTeams returns the unique, non-empty names from the first CSV column and
+// the role from the second one. A first row reading "username" or "team" is
+// treated as a header.
+func readTeams(path string) ([]importedTeam, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var teams []importedTeam
+	for i, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		name := strings.TrimSpace(strings.TrimPrefix(row[0], "\ufeff"))
+		if i == 0 && (strings.EqualFold(name, "username") || strings.EqualFold(name, "team")) {
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate team name %q on line %d", name, i+1)
+		}
+		role := ""
+		if len(row) > 1 {
+			role = strings.TrimSpace(row[1])
+		}
+		if !validRole(role) {
+			return nil, fmt.Errorf("unknown role %q on line %d", role, i+1)
+		}
+		seen[name] = true
+		teams = append(teams, importedTeam{Name: name, Role: role})
+	}
+	if len(teams) == 0 {
+		return nil, fmt.Errorf("no team names found in %s", path)
+	}
+	return teams, nil
+}
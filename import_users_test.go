@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadTeams(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []importedTeam
+		wantErr string
+	}{
+		{"names", "a\nb\n", []importedTeam{{Name: "a"}, {Name: "b"}}, ""},
+		{"header and bom", "\ufeffusername,role\na,admin\n", []importedTeam{{Name: "a", Role: roleAdmin}}, ""},
+		{"team header", "Team\nتیم یک\n", []importedTeam{{Name: "تیم یک"}}, ""},
+		{"blank rows and spaces", "  a  \n\n,\nb, contestant\n", []importedTeam{{Name: "a"}, {Name: "b", Role: roleContestant}}, ""},
+		{"duplicate", "a\nb\na\n", nil, `duplicate team name "a" on line 3`},
+		{"unknown role", "a,judge\n", nil, `unknown role "judge" on line 1`},
+		{"empty", "username\n\n", nil, "no team names"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "teams.csv")
+			if err := os.WriteFile(path, []byte(tt.csv), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readTeams(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("teams = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("team %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunImportUsers(t *testing.T) {
+	dir := t.TempDir()
+	csvPath, out, sheet := filepath.Join(dir, "teams.csv"), filepath.Join(dir, "users.json"), filepath.Join(dir, "sheet.csv")
+	if err := os.WriteFile(csvPath, []byte("a\nb,admin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"-csv", csvPath, "-out", out, "-sheet", sheet, "-length", "8"}
+	if err := runImportUsers(args, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		t.Fatal(err)
+	}
+	sheetData, err := os.ReadFile(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(string(sheetData)), "\n")
+	if len(users) != 2 || len(rows) != 3 || users[1].Role != roleAdmin {
+		t.Fatalf("users = %+v, sheet = %q", users, rows)
+	}
+	// the sheet's passwords log in against the written hashes
+	for i, row := range rows[1:] {
+		username, password, _ := strings.Cut(row, ",")
+		if users[i].Username != username || len(password) != 8 || !verifyPassword(users[i].Password, password, false) {
+			t.Errorf("user %+v does not match sheet row %q", users[i], row)
+		}
+	}
+	if info, err := os.Stat(sheet); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("sheet mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	// an existing file needs -force, and is kept without it
+	if err := runImportUsers(args, io.Discard); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Errorf("second import err = %v, want -force", err)
+	}
+	if again, _ := os.ReadFile(out); string(again) != string(data) {
+		t.Error("users.json changed without -force")
+	}
+	if err := runImportUsers(append(args, "-force"), io.Discard); err != nil {
+		t.Errorf("import with -force: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// -------- State events and the write-ahead journal --------
+
+// Every change to a user's state is a stateEvent. It is handed to the store
+// before it is applied in memory. The JSON store appends it to the journal and
+// fsyncs; on startup the journal is replayed on top of the last state.json
+// snapshot, entries already contained in the snapshot are skipped by sequence
+// number. A successful snapshot compacts the journal.
+
+const (
+	eventAttempt   = "attempt"
+	eventPrompt    = "prompt"
+	eventHint      = "hint"
+	eventRateLimit = "rate_limit"
+	eventReveal    = "reveal"   // Username's results revealed on the frozen scoreboard
+	eventUnfreeze  = "unfreeze" // whole scoreboard unfrozen
+
+	eventAnnouncement       = "announcement"
+	eventClarification      = "clarification"       // a team asked
+	eventClarificationReply = "clarification_reply" // carries the whole answered clarification
+)
+
+type stateEvent struct {
+	Seq        int64  `json:"seq"`
+	Type       string `json:"type"`
+	Username   string `json:"username"`
+	QuestionID int    `json:"question_id"`
+
+	Attempt   *AttemptRecord   `json:"attempt,omitempty"`
+	Prompt    *PromptRecord    `json:"prompt,omitempty"`
+	Hint      *HintReveal      `json:"hint,omitempty"`
+	RateLimit *RateLimitRecord `json:"rate_limit,omitempty"`
+
+	Announcement  *Announcement  `json:"announcement,omitempty"`
+	Clarification *Clarification `json:"clarification,omitempty"`
+
+	// user totals after the entry was applied, so replay does not depend on
+	// the questions as they are at restart time
+	TotalScore         int `json:"total_score"`
+	LastSolvedQuestion int `json:"last_solved_question"`
+	// other teams' solves of a dynamic question that this solve devalued
+	Adjustments []scoreAdjustment `json:"adjustments,omitempty"`
+}
+
+type journal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func openJournal(path string) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{path: path, f: f}, nil
+}
+
+func (j *journal) append(e stateEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// compact drops the entries up to and including seq once they are part of a
+// snapshot. Entries appended after the snapshot was taken are kept. A line
+// that is unterminated or does not parse can only be a write torn by a crash,
+// replay refuses one anywhere but at the end; it is dropped so the next
+// append does not continue it.
+func (j *journal) compact(seq int64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return err
+	}
+	keep := data[:0]
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i+1], data[i+1:]
+		} else {
+			data = nil
+		}
+		var e struct {
+			Seq int64 `json:"seq"`
+		}
+		if line[len(line)-1] != '\n' || json.Unmarshal(line, &e) != nil {
+			log.Printf("journal: dropping a torn entry of %d bytes", len(line))
+			continue
+		}
+		if e.Seq <= seq {
+			continue
+		}
+		keep = append(keep, line...)
+	}
+
+	if err := writeFileAtomic(j.path, keep, 0644); err != nil {
+		return err
+	}
+	// the old descriptor points at the replaced file
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	j.f.Close()
+	j.f = f
+	return nil
+}
+
+func (j *journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+// recordEvent hands e to the store and then applies it to the in-memory
+// state. Nothing is applied if the store rejects it. Callers must hold
+// stateMu for writing.
+func recordEvent(e stateEvent) error {
+	e.Seq = state.JournalSeq + 1
+	if err := dataStore.AppendEvent(e); err != nil {
+		log.Printf("failed to store %s event: %v", e.Type, err)
+		return err
+	}
+	applyEvent(state, e)
+	markStateDirty()
+	switch e.Type {
+	case eventAttempt, eventHint, eventReveal, eventUnfreeze:
+		scoreboardChanged()
+	}
+	publishStateEvent(e)
+	return nil
+}
+
+// applyEvent is shared by the live path and startup replay.
+func applyEvent(st *InMemoryState, e stateEvent) {
+	switch e.Type {
+	case eventReveal:
+		if st.Revealed == nil {
+			st.Revealed = map[string]bool{}
+		}
+		st.Revealed[e.Username] = true
+	case eventUnfreeze:
+		st.Unfrozen = true
+	case eventAnnouncement:
+		st.Announcements = append(st.Announcements, *e.Announcement)
+	case eventClarification:
+		st.Clarifications = append(st.Clarifications, *e.Clarification)
+	case eventClarificationReply:
+		if cl := findClarification(st, e.Clarification.ID); cl != nil {
+			*cl = *e.Clarification
+		}
+	default:
+		applyUserEvent(st, e)
+	}
+	st.JournalSeq = e.Seq
+}
+
+func applyUserEvent(st *InMemoryState, e stateEvent) {
+	us, ok := st.Users[e.Username]
+	if !ok {
+		us = &UserState{
+			Username:    e.Username,
+			PerQuestion: map[int]*UserQuestionState{},
+		}
+		st.Users[e.Username] = us
+	}
+	if us.PerQuestion == nil {
+		us.PerQuestion = map[int]*UserQuestionState{}
+	}
+	qs, ok := us.PerQuestion[e.QuestionID]
+	if !ok {
+		qs = &UserQuestionState{AttemptHistory: []AttemptRecord{}}
+		us.PerQuestion[e.QuestionID] = qs
+	}
+
+	switch e.Type {
+	case eventAttempt:
+		qs.AttemptHistory = append(qs.AttemptHistory, *e.Attempt)
+		us.TotalScore = e.TotalScore
+		us.LastSolvedQuestion = e.LastSolvedQuestion
+		for _, a := range e.Adjustments {
+			applyScoreAdjustment(st, e.QuestionID, a)
+		}
+	case eventPrompt:
+		qs.PromptHistory = append(qs.PromptHistory, *e.Prompt)
+	case eventHint:
+		qs.HintReveals = append(qs.HintReveals, *e.Hint)
+		us.TotalScore = e.TotalScore
+		us.LastSolvedQuestion = e.LastSolvedQuestion
+	case eventRateLimit:
+		qs.RateLimits = append(qs.RateLimits, *e.RateLimit)
+	}
+}
+
+func applyScoreAdjustment(st *InMemoryState, questionID int, a scoreAdjustment) {
+	us, ok := st.Users[a.Username]
+	if !ok {
+		return
+	}
+	qs, ok := us.PerQuestion[questionID]
+	if !ok || a.Index >= len(qs.AttemptHistory) {
+		return
+	}
+	qs.AttemptHistory[a.Index].Score = a.Score
+	us.TotalScore = a.TotalScore
+}
+
+func validateEvent(e stateEvent) error {
+	switch e.Type {
+	case eventAttempt:
+		if e.Attempt == nil {
+			return errors.New("attempt entry without attempt")
+		}
+	case eventPrompt:
+		if e.Prompt == nil {
+			return errors.New("prompt entry without prompt")
+		}
+	case eventHint:
+		if e.Hint == nil {
+			return errors.New("hint entry without hint")
+		}
+	case eventRateLimit:
+		if e.RateLimit == nil {
+			return errors.New("rate_limit entry without rate_limit")
+		}
+	case eventReveal, eventUnfreeze:
+	case eventAnnouncement:
+		if e.Announcement == nil {
+			return errors.New("announcement entry without announcement")
+		}
+	case eventClarification, eventClarificationReply:
+		if e.Clarification == nil {
+			return fmt.Errorf("%s entry without clarification", e.Type)
+		}
+	default:
+		return fmt.Errorf("unknown entry type %q", e.Type)
+	}
+	return nil
+}
+
+// replayJournal applies the journal entries newer than the snapshot st.
+// A torn last line from a crash mid-append is ignored, any other damage is
+// an error so we never start from a silently truncated history.
+func replayJournal(path string, st *InMemoryState) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	applied := 0
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(data) > 0 {
+				log.Printf("journal: ignoring incomplete last entry on line %d", line)
+			}
+			return applied, nil
+		}
+		if err != nil {
+			return applied, err
+		}
+
+		var e stateEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return applied, fmt.Errorf("journal line %d: %w", line, err)
+		}
+		if e.Seq <= st.JournalSeq {
+			continue
+		}
+		if e.Seq != st.JournalSeq+1 {
+			return applied, fmt.Errorf("journal line %d: expected seq %d, got %d", line, st.JournalSeq+1, e.Seq)
+		}
+		if err := validateEvent(e); err != nil {
+			return applied, fmt.Errorf("journal line %d: %w", line, err)
+		}
+		applyEvent(st, e)
+		applied++
+	}
+}
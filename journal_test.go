@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAttemptEvent(seq int64, username string, questionID int, correct bool, total int) stateEvent {
+	return stateEvent{
+		Seq:        seq,
+		Type:       eventAttempt,
+		Username:   username,
+		QuestionID: questionID,
+		Attempt: &AttemptRecord{
+			QuestionID: questionID,
+			Answer:     "answer",
+			Correct:    correct,
+			At:         time.Date(2025, 1, 1, 10, 0, int(seq), 0, time.UTC),
+		},
+		TotalScore: total,
+	}
+}
+
+func writeJournal(t *testing.T, events []stateEvent, tail string) string {
+	t.Helper()
+	var sb strings.Builder
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(tail)
+	path := filepath.Join(t.TempDir(), "state.journal")
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestState(seq int64) *InMemoryState {
+	return &InMemoryState{Users: map[string]*UserState{}, JournalSeq: seq}
+}
+
+func TestReplayJournal(t *testing.T) {
+	events := []stateEvent{
+		testAttemptEvent(1, "a", 1, false, 0),
+		testAttemptEvent(2, "a", 1, true, 10),
+		testAttemptEvent(3, "b", 1, true, 10),
+	}
+	torn := `{"seq":4,"type":"attempt","username":"b","question_id":2,"att`
+
+	tests := []struct {
+		name        string
+		events      []stateEvent
+		tail        string
+		snapshotSeq int64
+		wantApplied int
+		wantSeq     int64
+		wantErr     string
+	}{
+		{name: "empty", wantApplied: 0, wantSeq: 0},
+		{name: "all entries", events: events, wantApplied: 3, wantSeq: 3},
+		{name: "torn last line is ignored", events: events, tail: torn, wantApplied: 3, wantSeq: 3},
+		{name: "only a torn line", tail: torn, wantApplied: 0, wantSeq: 0},
+		{name: "entries in the snapshot are skipped", events: events, snapshotSeq: 2, wantApplied: 1, wantSeq: 3},
+		{name: "snapshot newer than the journal", events: events, snapshotSeq: 5, wantApplied: 0, wantSeq: 5},
+		{
+			name:        "compacted journal continues after the snapshot",
+			events:      events[2:],
+			snapshotSeq: 2,
+			wantApplied: 1,
+			wantSeq:     3,
+		},
+		{
+			name:        "gap after the snapshot",
+			events:      events[2:],
+			snapshotSeq: 1,
+			wantSeq:     1,
+			wantErr:     "expected seq 2, got 3",
+		},
+		{
+			name:        "damaged line before the end",
+			events:      events[:1],
+			tail:        "not json\n" + torn,
+			wantApplied: 1,
+			wantSeq:     1,
+			wantErr:     "journal line 2",
+		},
+		{
+			name:    "entry without its payload",
+			tail:    `{"seq":1,"type":"attempt","username":"a"}` + "\n",
+			wantErr: "attempt entry without attempt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeJournal(t, tt.events, tt.tail)
+			st := newTestState(tt.snapshotSeq)
+			applied, err := replayJournal(path, st)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if applied != tt.wantApplied {
+				t.Errorf("applied = %d, want %d", applied, tt.wantApplied)
+			}
+			if st.JournalSeq != tt.wantSeq {
+				t.Errorf("JournalSeq = %d, want %d", st.JournalSeq, tt.wantSeq)
+			}
+		})
+	}
+}
+
+func TestReplayJournalAppliesTotals(t *testing.T) {
+	path := writeJournal(t, []stateEvent{
+		testAttemptEvent(1, "a", 1, false, 0),
+		testAttemptEvent(2, "a", 1, true, 10),
+	}, `{"seq":3,"type":"attempt","username":"a","question_id":2,"attempt":{"correct":tr`)
+	st := newTestState(0)
+	if _, err := replayJournal(path, st); err != nil {
+		t.Fatal(err)
+	}
+	us := st.Users["a"]
+	if us == nil {
+		t.Fatal("user a not replayed")
+	}
+	if us.TotalScore != 10 {
+		t.Errorf("TotalScore = %d, want 10", us.TotalScore)
+	}
+	if got := len(us.PerQuestion[1].AttemptHistory); got != 2 {
+		t.Errorf("attempts on question 1 = %d, want 2", got)
+	}
+	if _, ok := us.PerQuestion[2]; ok {
+		t.Error("torn entry for question 2 was applied")
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.journal")
+	j, err := openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	for seq := int64(1); seq <= 3; seq++ {
+		if err := j.append(testAttemptEvent(seq, "a", 1, false, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.compact(2); err != nil {
+		t.Fatal(err)
+	}
+	// appends after compacting go to the new file
+	if err := j.append(testAttemptEvent(4, "a", 1, true, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	st := newTestState(2)
+	applied, err := replayJournal(path, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 2 || st.JournalSeq != 4 {
+		t.Errorf("applied %d up to seq %d, want 2 up to 4", applied, st.JournalSeq)
+	}
+
+	// a server that crashed before the snapshot was saved would see a gap
+	if _, err := replayJournal(path, newTestState(1)); err == nil {
+		t.Error("replay from an older snapshot succeeded, want a seq gap error")
+	}
+}
+
+// A crash mid-append leaves a fragment at the end of the journal. The restart
+// must drop it, or the next entry is glued onto it and the restart after that
+// cannot replay the journal.
+func TestJSONStoreTornTailRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{StateFilePath: filepath.Join(dir, "state.json"), JournalFilePath: filepath.Join(dir, "state.journal")}
+
+	store := newJSONStore(cfg)
+	st, err := store.LoadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq := int64(1); seq <= 2; seq++ {
+		if err := store.AppendEvent(testAttemptEvent(seq, "a", 1, false, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+	// the crash: half of entry 3
+	f, err := os.OpenFile(cfg.JournalFilePath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":3,"type":"attempt","username":"a","question_id":1,"att`)
+	f.Close()
+
+	store = newJSONStore(cfg)
+	if st, err = store.LoadState(); err != nil {
+		t.Fatalf("restart after the crash: %v", err)
+	}
+	if st.JournalSeq != 2 {
+		t.Fatalf("JournalSeq = %d after the crash, want 2", st.JournalSeq)
+	}
+	if err := store.AppendEvent(testAttemptEvent(3, "a", 1, true, 10)); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store = newJSONStore(cfg)
+	defer store.Close()
+	if st, err = store.LoadState(); err != nil {
+		t.Fatalf("second restart: %v", err)
+	}
+	if st.JournalSeq != 3 || st.Users["a"].TotalScore != 10 {
+		t.Errorf("after the second restart seq %d total %d, want 3 and 10", st.JournalSeq, st.Users["a"].TotalScore)
+	}
+}
+
+func TestJournalCompactDropsTornTail(t *testing.T) {
+	path := writeJournal(t, []stateEvent{testAttemptEvent(1, "a", 1, false, 0)}, `{"seq":2,"type":"att`)
+	j, err := openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if err := j.compact(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.append(testAttemptEvent(2, "a", 1, true, 10)); err != nil {
+		t.Fatal(err)
+	}
+	st := newTestState(0)
+	if applied, err := replayJournal(path, st); err != nil || applied != 2 {
+		t.Errorf("replay = %d, %v; want 2 entries", applied, err)
+	}
+}
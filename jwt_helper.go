@@ -9,13 +9,15 @@ import (
 
 type Claims struct {
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func generateJWT(username string) (string, time.Time, error) {
-	expiresAt := time.Now().Add(jwtExpiration)
+func generateJWT(cfg *Config, user User) (string, time.Time, error) {
+	expiresAt := time.Now().Add(cfg.JWTExpiration)
 	claims := Claims{
-		Username: username,
+		Username: user.Username,
+		Role:     user.GetRole(),
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    "quiz-backend",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -23,16 +25,16 @@ func generateJWT(username string) (string, time.Time, error) {
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(jwtSecret))
+	signed, err := token.SignedString([]byte(cfg.JWTSecret))
 	return signed, expiresAt, err
 }
 
-func parseJWT(tokenString string) (*Claims, error) {
+func parseJWT(cfg *Config, tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return []byte(jwtSecret), nil
+		return []byte(cfg.JWTSecret), nil
 	})
 	if err != nil {
 		return nil, err
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// -------- LLM providers --------
+
+const (
+	llmOpenAI = "openai" // any OpenAI compatible chat completions endpoint, Avalai included
+	llmOllama = "ollama" // Ollama's /api/chat
+	llmFake   = "fake"   // canned replies without a network, for tests and rehearsals
+
+	defaultLLMProvider = "avalai"
+	defaultLLMModel    = "gpt-4o-mini"
+	defaultLLMTimeout  = 30 * time.Second
+)
+
+// errors shown to the contestant, details only go to the log
+var (
+	errLLMInternal    = errors.New("internal server error")
+	errLLMUnavailable = errors.New("extenral API error")
+	errLLMNoResponse  = errors.New("no response from external API")
+)
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLMClient answers a conversation, messages start with the system prompt.
+type LLMClient interface {
+	Complete(ctx context.Context, messages []chatMessage) (string, error)
+}
+
+// LLMStreamer is implemented by clients that can hand out the answer while it
+// is generated. Stream calls onToken for every piece and returns the whole
+// answer, on error the part received so far.
+type LLMStreamer interface {
+	Stream(ctx context.Context, messages []chatMessage, onToken func(string)) (string, error)
+}
+
+// streamCompletion streams from client, or sends the whole answer as one
+// piece if it cannot stream.
+func streamCompletion(ctx context.Context, client LLMClient, messages []chatMessage, onToken func(string)) (string, error) {
+	if streamer, ok := client.(LLMStreamer); ok {
+		return streamer.Stream(ctx, messages, onToken)
+	}
+	result, err := client.Complete(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	onToken(result)
+	return result, nil
+}
+
+// LLMProviderConfig is one entry of llm_providers.
+type LLMProviderConfig struct {
+	Type   string `yaml:"type" json:"type"`
+	URL    string `yaml:"url" json:"url"`
+	Model  string `yaml:"model" json:"model"`
+	APIKey string `yaml:"api_key" json:"api_key"`
+	// environment variable holding the key, keeps it out of the config file
+	APIKeyEnv string        `yaml:"api_key_env" json:"api_key_env"`
+	Timeout   time.Duration `yaml:"timeout" json:"timeout"`
+	// fake only, returned for every prompt; empty echoes the last message
+	Reply string `yaml:"reply" json:"reply"`
+}
+
+func (p LLMProviderConfig) Validate() error {
+	switch p.Type {
+	case llmOpenAI, llmOllama:
+		if p.URL == "" {
+			return errors.New("url must not be empty")
+		}
+		if p.Model == "" {
+			return errors.New("model must not be empty")
+		}
+	case llmFake:
+	default:
+		return fmt.Errorf("type must be %q, %q or %q", llmOpenAI, llmOllama, llmFake)
+	}
+	if p.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	// without it every request would go out with an empty key and fail
+	if p.APIKeyEnv != "" && p.APIKey == "" && os.Getenv(p.APIKeyEnv) == "" {
+		return fmt.Errorf("api_key_env %s is not set", p.APIKeyEnv)
+	}
+	return nil
+}
+
+// llmProviders returns the configured providers. Without llm_providers the
+// Avalai settings make up the only one, as before providers were configurable.
+func (cfg *Config) llmProviders() map[string]LLMProviderConfig {
+	if len(cfg.LLMProviders) > 0 {
+		return cfg.LLMProviders
+	}
+	return map[string]LLMProviderConfig{
+		defaultLLMProvider: {Type: llmOpenAI, URL: cfg.AvalaiAPIURL, Model: defaultLLMModel, APIKey: cfg.AvalaiAPIKey},
+	}
+}
+
+// llmRouter picks the client for a system prompt.
+type llmRouter struct {
+	clients         map[string]LLMClient
+	defaultProvider string
+	bySystemPrompt  map[int]string
+}
+
+// newLLMRouter builds a client per provider, cfg is already validated.
+func newLLMRouter(cfg *Config) *llmRouter {
+	r := &llmRouter{
+		clients:         map[string]LLMClient{},
+		defaultProvider: cfg.DefaultLLMProvider,
+		bySystemPrompt:  cfg.SystemPromptProviders,
+	}
+	for name, p := range cfg.llmProviders() {
+		r.clients[name] = newLLMClient(p)
+	}
+	return r
+}
+
+func newLLMClient(p LLMProviderConfig) LLMClient {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = defaultLLMTimeout
+	}
+	httpClient := &http.Client{Timeout: timeout}
+	switch p.Type {
+	case llmOllama:
+		return &ollamaClient{url: p.URL, model: p.Model, http: httpClient}
+	case llmFake:
+		return fakeLLMClient{reply: p.Reply}
+	default:
+		apiKey := p.APIKey
+		if p.APIKeyEnv != "" {
+			overrideString(&apiKey, os.Getenv(p.APIKeyEnv))
+		}
+		return &openAIClient{url: p.URL, model: p.Model, apiKey: apiKey, http: httpClient}
+	}
+}
+
+// For returns the client answering with systemPromptID.
+func (r *llmRouter) For(systemPromptID int) LLMClient {
+	if name, ok := r.bySystemPrompt[systemPromptID]; ok {
+		return r.clients[name]
+	}
+	return r.clients[r.defaultProvider]
+}
+
+// postLLM sends body to url and returns the response if it is a 200, the
+// caller closes it.
+func postLLM(ctx context.Context, client *http.Client, url, apiKey string, body any) (*http.Response, error) {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Error marshaling request: %v", err)
+		return nil, errLLMInternal
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		log.Printf("Error creating request: %v", err)
+		return nil, errLLMInternal
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		log.Printf("Error calling external API: %v", err)
+		return nil, errLLMUnavailable
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		log.Printf("External API error: %d - %s", resp.StatusCode, string(respBody))
+		return nil, errLLMUnavailable
+	}
+	return resp, nil
+}
+
+// postLLMStream is postLLM for streamed answers, which may take much longer
+// than client.Timeout in total. That timeout limits the wait for the response
+// headers and then for each following piece instead.
+func postLLMStream(ctx context.Context, client *http.Client, url, apiKey string, body any) (*http.Response, error) {
+	idle := client.Timeout
+	if idle == 0 {
+		return postLLM(ctx, client, url, apiKey, body)
+	}
+	streamClient := *client
+	streamClient.Timeout = 0
+
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(idle, cancel)
+	resp, err := postLLM(ctx, &streamClient, url, apiKey, body)
+	if err != nil {
+		timer.Stop()
+		cancel()
+		return nil, err
+	}
+	resp.Body = &idleTimeoutBody{ReadCloser: resp.Body, timer: timer, idle: idle, cancel: cancel}
+	return resp, nil
+}
+
+// idleTimeoutBody cancels the request when nothing arrives for idle.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timer  *time.Timer
+	idle   time.Duration
+	cancel context.CancelFunc
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.idle)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// postJSON sends body to url and decodes a 200 response into out.
+func postJSON(ctx context.Context, client *http.Client, url, apiKey string, body, out any) error {
+	resp, err := postLLM(ctx, client, url, apiKey, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error reading response: %v", err)
+		return errLLMUnavailable
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		log.Printf("Error unmarshaling response: %v", err)
+		return errLLMUnavailable
+	}
+	return nil
+}
+
+// openAIClient talks to a /v1/chat/completions endpoint.
+type openAIClient struct {
+	url    string
+	model  string
+	apiKey string
+	http   *http.Client
+}
+
+type openAIChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (c *openAIClient) Complete(ctx context.Context, messages []chatMessage) (string, error) {
+	var resp openAIChatResponse
+	if err := postJSON(ctx, c.http, c.url, c.apiKey, openAIChatRequest{Model: c.model, Messages: messages}, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errLLMNoResponse
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta chatMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+// Stream reads the server-sent events of a "stream": true completion.
+func (c *openAIClient) Stream(ctx context.Context, messages []chatMessage, onToken func(string)) (string, error) {
+	resp, err := postLLMStream(ctx, c.http, c.url, c.apiKey, openAIChatRequest{Model: c.model, Messages: messages, Stream: true})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // comments, event names and the blank lines between events
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return result.String(), nil
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			log.Printf("Error unmarshaling stream chunk: %v", err)
+			return result.String(), errLLMUnavailable
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			result.WriteString(chunk.Choices[0].Delta.Content)
+			onToken(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading stream: %v", err)
+		return result.String(), errLLMUnavailable
+	}
+	// some servers just close the stream instead of sending [DONE]
+	if result.Len() == 0 {
+		return "", errLLMNoResponse
+	}
+	return result.String(), nil
+}
+
+// ollamaClient talks to Ollama's /api/chat, or a local server mimicking it.
+type ollamaClient struct {
+	url   string
+	model string
+	http  *http.Client
+}
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type ollamaChatResponse struct {
+	Message chatMessage `json:"message"`
+	Done    bool        `json:"done"`
+	Error   string      `json:"error"`
+}
+
+func (c *ollamaClient) Complete(ctx context.Context, messages []chatMessage) (string, error) {
+	var resp ollamaChatResponse
+	if err := postJSON(ctx, c.http, c.url, "", ollamaChatRequest{Model: c.model, Messages: messages}, &resp); err != nil {
+		return "", err
+	}
+	if resp.Message.Content == "" {
+		return "", errLLMNoResponse
+	}
+	return resp.Message.Content, nil
+}
+
+// Stream reads Ollama's newline delimited JSON stream.
+func (c *ollamaClient) Stream(ctx context.Context, messages []chatMessage, onToken func(string)) (string, error) {
+	resp, err := postLLMStream(ctx, c.http, c.url, "", ollamaChatRequest{Model: c.model, Messages: messages, Stream: true})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result strings.Builder
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaChatResponse
+		if err := dec.Decode(&chunk); err != nil {
+			if err == io.EOF && result.Len() > 0 {
+				return result.String(), nil
+			}
+			log.Printf("Error reading stream: %v", err)
+			return result.String(), errLLMUnavailable
+		}
+		if chunk.Error != "" {
+			log.Printf("External API error: %s", chunk.Error)
+			return result.String(), errLLMUnavailable
+		}
+		if chunk.Message.Content != "" {
+			result.WriteString(chunk.Message.Content)
+			onToken(chunk.Message.Content)
+		}
+		if chunk.Done {
+			return result.String(), nil
+		}
+	}
+}
+
+// fakeLLMClient answers at once and always the same way for the same input.
+type fakeLLMClient struct {
+	reply string
+}
+
+func (c fakeLLMClient) Complete(ctx context.Context, messages []chatMessage) (string, error) {
+	if c.reply != "" {
+		return c.reply, nil
+	}
+	if len(messages) == 0 {
+		return "", errLLMNoResponse
+	}
+	return "echo: " + messages[len(messages)-1].Content, nil
+}
+
+// Stream sends the reply word by word.
+func (c fakeLLMClient) Stream(ctx context.Context, messages []chatMessage, onToken func(string)) (string, error) {
+	result, err := c.Complete(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	for _, word := range strings.SplitAfter(result, " ") {
+		onToken(word)
+	}
+	return result, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLLMProviderConfigValidate(t *testing.T) {
+	t.Setenv("QUIZ_TEST_LLM_KEY", "secret")
+	t.Setenv("QUIZ_TEST_LLM_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		p       LLMProviderConfig
+		wantErr string
+	}{
+		{"fake", LLMProviderConfig{Type: llmFake}, ""},
+		{"openai", LLMProviderConfig{Type: llmOpenAI, URL: "http://llm", Model: "m", APIKey: "k"}, ""},
+		{"unknown type", LLMProviderConfig{Type: "claude"}, "type must be"},
+		{"no url", LLMProviderConfig{Type: llmOllama, Model: "m"}, "url"},
+		{"no model", LLMProviderConfig{Type: llmOpenAI, URL: "http://llm"}, "model"},
+		{"negative timeout", LLMProviderConfig{Type: llmFake, Timeout: -1}, "timeout"},
+		{"key from env", LLMProviderConfig{Type: llmOpenAI, URL: "http://llm", Model: "m", APIKeyEnv: "QUIZ_TEST_LLM_KEY"}, ""},
+		{"env unset", LLMProviderConfig{Type: llmOpenAI, URL: "http://llm", Model: "m", APIKeyEnv: "QUIZ_TEST_LLM_UNSET"}, "QUIZ_TEST_LLM_UNSET is not set"},
+		{"env empty", LLMProviderConfig{Type: llmOpenAI, URL: "http://llm", Model: "m", APIKeyEnv: "QUIZ_TEST_LLM_EMPTY"}, "is not set"},
+		{"env unset, api_key as fallback", LLMProviderConfig{Type: llmOpenAI, URL: "http://llm", Model: "m", APIKey: "k", APIKeyEnv: "QUIZ_TEST_LLM_UNSET"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// slowOpenAIServer streams pieces with gap between them and stalls for stall
+// after the first one.
+func slowOpenAIServer(t *testing.T, pieces []string, gap, stall time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, piece := range pieces {
+			switch {
+			case i == 1 && stall > 0:
+				select {
+				case <-time.After(stall):
+				case <-r.Context().Done():
+					return
+				}
+			case i > 0:
+				time.Sleep(gap)
+			}
+			fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", piece)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAIStreamTimeout(t *testing.T) {
+	pieces := []string{"a ", "b ", "c ", "d ", "e"}
+	tests := []struct {
+		name       string
+		gap, stall time.Duration
+		want       string
+		wantErr    bool
+	}{
+		// 5 pieces 60ms apart take longer than the 150ms timeout in total
+		{"long stream with short gaps", 60 * time.Millisecond, 0, "a b c d e", false},
+		{"stalled stream", 0, time.Second, "a ", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := slowOpenAIServer(t, pieces, tt.gap, tt.stall)
+			client := newLLMClient(LLMProviderConfig{Type: llmOpenAI, URL: srv.URL, Model: "m", Timeout: 150 * time.Millisecond})
+
+			var tokens []string
+			result, err := client.(LLMStreamer).Stream(context.Background(), []chatMessage{{Role: "user", Content: "hi"}}, func(token string) {
+				tokens = append(tokens, token)
+			})
+			if result != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("Stream = %q, %v; want %q, error %t", result, err, tt.want, tt.wantErr)
+			}
+			if strings.Join(tokens, "") != tt.want {
+				t.Errorf("tokens = %q, want %q", tokens, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------- Login brute-force protection --------
+
+const recentLoginFailures = 200
+
+// loginGuard counts failed logins per username and per client IP. After
+// maxFailures (maxIPFailures for IPs) failures in a row the key is locked,
+// for backoff at first and twice as long after every further failure, up to
+// maxBackoff. A key is forgotten once it has not failed for maxBackoff.
+type loginGuard struct {
+	maxFailures   int
+	maxIPFailures int
+	backoff       time.Duration
+	maxBackoff    time.Duration
+
+	mu        sync.Mutex
+	byUser    map[string]*loginFailures
+	byIP      map[string]*loginFailures
+	recent    []failedLogin // oldest first, at most recentLoginFailures
+	lastPrune time.Time
+}
+
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+type failedLogin struct {
+	Username string    `json:"username"`
+	IP       string    `json:"ip"`
+	At       time.Time `json:"at"`
+}
+
+func newLoginGuard(cfg *Config) *loginGuard {
+	return &loginGuard{
+		maxFailures:   cfg.LoginMaxFailures,
+		maxIPFailures: cfg.LoginMaxIPFailures,
+		backoff:       cfg.LoginBackoff,
+		maxBackoff:    cfg.LoginMaxBackoff,
+		byUser:        map[string]*loginFailures{},
+		byIP:          map[string]*loginFailures{},
+	}
+}
+
+// Reserve counts a login attempt as failed before the password is checked,
+// so concurrent attempts cannot all pass the lockout check, and returns how
+// long username and ip must still wait, 0 if they may try. Unknown usernames
+// are only counted by IP, so guessing names cannot grow the table. A
+// successful attempt gives the reservation back with Succeed.
+func (g *loginGuard) Reserve(username, ip string, knownUser bool, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune(now)
+
+	var wait time.Duration
+	if f, ok := g.byUser[username]; ok {
+		wait = max(wait, f.lockedUntil.Sub(now))
+	}
+	if f, ok := g.byIP[ip]; ok {
+		wait = max(wait, f.lockedUntil.Sub(now))
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if knownUser {
+		g.reserve(g.byUser, username, g.maxFailures, now)
+	}
+	g.reserve(g.byIP, ip, g.maxIPFailures, now)
+	return 0
+}
+
+func (g *loginGuard) reserve(failures map[string]*loginFailures, key string, maxFailures int, now time.Time) {
+	f, ok := failures[key]
+	if !ok || now.Sub(f.last) > g.maxBackoff {
+		f = &loginFailures{}
+		failures[key] = f
+	}
+	f.count++
+	f.last = now
+	f.lockedUntil = g.lockedUntil(f, maxFailures)
+}
+
+// lockedUntil is when f stops being locked, zero while it is under maxFailures.
+// The lock lasts backoff and doubles with every further failure.
+func (g *loginGuard) lockedUntil(f *loginFailures, maxFailures int) time.Time {
+	over := f.count - maxFailures
+	if over <= 0 {
+		return time.Time{}
+	}
+	wait := g.maxBackoff
+	if over <= 30 { // 2^30 times any sane backoff is past the cap
+		wait = min(g.backoff<<(over-1), g.maxBackoff)
+	}
+	return f.last.Add(wait)
+}
+
+// Fail logs a failed login, it was already counted by Reserve.
+func (g *loginGuard) Fail(username, ip string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	count := 0
+	if f, ok := g.byIP[ip]; ok {
+		count = f.count
+	}
+	g.recent = append(g.recent, failedLogin{Username: username, IP: ip, At: now})
+	if len(g.recent) > recentLoginFailures {
+		g.recent = g.recent[len(g.recent)-recentLoginFailures:]
+	}
+	log.Printf("failed login for %q from %s (%d from this ip)", username, ip, count)
+}
+
+// Succeed clears the failures of username and gives the IP the attempt
+// reserved at reservedAt back, the IP was not locked then. The IP keeps its
+// earlier failures, one valid account must not reset guessing at the others.
+func (g *loginGuard) Succeed(username, ip string, reservedAt time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.byUser, username)
+	if f, ok := g.byIP[ip]; ok && f.count > 0 {
+		f.count--
+		if f.lockedUntil = g.lockedUntil(f, g.maxIPFailures); f.lockedUntil.After(reservedAt) {
+			f.lockedUntil = reservedAt
+		}
+	}
+}
+
+// Unlock clears the failures of username and reports whether there were any.
+func (g *loginGuard) Unlock(username string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.byUser[username]
+	delete(g.byUser, username)
+	return ok
+}
+
+func (g *loginGuard) prune(now time.Time) {
+	if now.Sub(g.lastPrune) < g.maxBackoff {
+		return
+	}
+	g.lastPrune = now
+	for _, failures := range []map[string]*loginFailures{g.byUser, g.byIP} {
+		for key, f := range failures {
+			if now.Sub(f.last) > g.maxBackoff {
+				delete(failures, key)
+			}
+		}
+	}
+}
+
+type loginLockout struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+type adminLoginsResponse struct {
+	LockedUsers    []loginLockout `json:"locked_users"`
+	LockedIPs      []loginLockout `json:"locked_ips"`
+	RecentFailures []failedLogin  `json:"recent_failures"`
+}
+
+func (g *loginGuard) report(now time.Time) adminLoginsResponse {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	locked := func(failures map[string]*loginFailures) []loginLockout {
+		out := []loginLockout{}
+		for key, f := range failures {
+			if f.lockedUntil.After(now) {
+				out = append(out, loginLockout{Key: key, Failures: f.count, LockedUntil: f.lockedUntil})
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+		return out
+	}
+	recent := make([]failedLogin, len(g.recent))
+	// newest first
+	for i, f := range g.recent {
+		recent[len(recent)-1-i] = f
+	}
+	return adminLoginsResponse{
+		LockedUsers:    locked(g.byUser),
+		LockedIPs:      locked(g.byIP),
+		RecentFailures: recent,
+	}
+}
+
+// adminLoginsHandler lists current lockouts and the most recent failed logins.
+func adminLoginsHandler(guard *loginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, guard.report(time.Now()))
+	}
+}
+
+// adminUnlockUserHandler lifts a username lockout before it expires.
+func adminUnlockUserHandler(guard *loginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("username")
+		if _, ok := usersByUsername[username]; !ok {
+			c.JSON(http.StatusNotFound, baseResponse{OK: false, Description: "unknown user"})
+			return
+		}
+		if !guard.Unlock(username) {
+			c.JSON(http.StatusOK, baseResponse{OK: true, Description: "user was not locked"})
+			return
+		}
+		log.Printf("login lockout of %q lifted by %s", username, c.MustGet(claimsKey).(*Claims).Username)
+		c.JSON(http.StatusOK, baseResponse{OK: true, Description: "user unlocked"})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testLoginGuard() *loginGuard {
+	return newLoginGuard(&Config{
+		LoginMaxFailures:   3,
+		LoginMaxIPFailures: 5,
+		LoginBackoff:       time.Minute,
+		LoginMaxBackoff:    10 * time.Minute,
+	})
+}
+
+// failLogin makes a failed attempt and returns the wait Reserve asked for.
+func failLogin(g *loginGuard, username, ip string, knownUser bool, now time.Time) time.Duration {
+	if wait := g.Reserve(username, ip, knownUser, now); wait > 0 {
+		return wait
+	}
+	g.Fail(username, ip, now)
+	return 0
+}
+
+func TestLoginGuardLockout(t *testing.T) {
+	g := testLoginGuard()
+	g.maxIPFailures = 100
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// three failures are free, the fourth locks for the backoff
+	for i := 0; i < 4; i++ {
+		if wait := failLogin(g, "a", "ip1", true, now); wait != 0 {
+			t.Fatalf("attempt %d locked for %v", i+1, wait)
+		}
+	}
+	// the lock holds for the user from any ip, not for other users on the ip
+	if wait := g.Reserve("a", "ip2", true, now); wait != time.Minute {
+		t.Errorf("wait after 4 failures = %v, want 1m", wait)
+	}
+	if wait := g.Reserve("b", "ip1", true, now); wait != 0 {
+		t.Errorf("other user locked for %v", wait)
+	}
+
+	// each further failure doubles the lock
+	now = now.Add(time.Minute)
+	if wait := failLogin(g, "a", "ip1", true, now); wait != 0 {
+		t.Fatalf("attempt after the lock expired locked for %v", wait)
+	}
+	if wait := g.Reserve("a", "ip1", true, now.Add(time.Second)); wait != 2*time.Minute-time.Second {
+		t.Errorf("wait after 5 failures = %v, want 2m", wait)
+	}
+
+	// a success clears the user
+	now = now.Add(2 * time.Minute)
+	if wait := g.Reserve("a", "ip1", true, now); wait != 0 {
+		t.Fatalf("wait after the lock expired = %v", wait)
+	}
+	g.Succeed("a", "ip1", now)
+	if wait := failLogin(g, "a", "ip1", true, now); wait != 0 {
+		t.Errorf("failure after a success locked for %v", wait)
+	}
+	if got := g.byUser["a"].count; got != 1 {
+		t.Errorf("count after a success and a failure = %d, want 1", got)
+	}
+}
+
+func TestLoginGuardForgets(t *testing.T) {
+	g := testLoginGuard()
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		failLogin(g, "a", "ip1", true, now)
+	}
+
+	// quiet for longer than the maximum backoff, the count starts over
+	now = now.Add(11 * time.Minute)
+	for i := 0; i < 4; i++ {
+		if wait := failLogin(g, "a", "ip1", true, now); wait != 0 {
+			t.Fatalf("attempt %d after the pause locked for %v", i+1, wait)
+		}
+	}
+	if got := g.byUser["a"].count; got != 4 {
+		t.Errorf("count = %d, want 4", got)
+	}
+}
+
+func TestLoginGuardIP(t *testing.T) {
+	g := testLoginGuard()
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// guessing names is counted by ip only and does not grow the user table
+	for i := 0; i < 6; i++ {
+		if wait := failLogin(g, "guess"+string(rune('a'+i)), "ip1", false, now); wait != 0 {
+			t.Fatalf("attempt %d locked for %v", i+1, wait)
+		}
+	}
+	if len(g.byUser) != 0 {
+		t.Errorf("unknown users counted: %v", g.byUser)
+	}
+	if wait := g.Reserve("a", "ip1", true, now); wait != time.Minute {
+		t.Errorf("ip wait = %v, want 1m", wait)
+	}
+	if wait := g.Reserve("a", "ip2", true, now); wait != 0 {
+		t.Errorf("other ip locked for %v", wait)
+	}
+
+	// a success clears the user and gives the ip its attempt back, without
+	// forgetting the earlier failures or locking the ip
+	now = now.Add(time.Minute)
+	g.Reserve("a", "ip1", true, now)
+	g.Succeed("a", "ip1", now)
+	if _, ok := g.byUser["a"]; ok {
+		t.Error("user failures kept after a success")
+	}
+	if f := g.byIP["ip1"]; f.count != 6 || f.lockedUntil.After(now) {
+		t.Errorf("ip after a success = %+v, want 6 failures and no lock", f)
+	}
+	if wait := failLogin(g, "b", "ip1", true, now); wait != 0 {
+		t.Errorf("ip locked for %v after a success", wait)
+	}
+	if wait := g.Reserve("c", "ip1", true, now); wait != 2*time.Minute {
+		t.Errorf("ip wait after one more failure = %v, want 2m", wait)
+	}
+}
+
+func TestLoginGuardConcurrentAttempts(t *testing.T) {
+	g := testLoginGuard()
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	var tried atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if g.Reserve("a", "ip"+string(rune('a'+i)), true, now) == 0 {
+				tried.Add(1)
+				g.Fail("a", "ip", now)
+			}
+		}()
+	}
+	wg.Wait()
+	// as many as one after the other: three free failures and the one that locks
+	if got := tried.Load(); got != 4 {
+		t.Errorf("%d attempts got through, want 4", got)
+	}
+}
@@ -1,15 +1,71 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	LoadData()
-	srv := RegisterHandlers()
-	log.Printf("server listening on %s", srv.Addr)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("server error: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "import-users" {
+		if err := runImportUsers(os.Args[2:], os.Stdout); err != nil && !errors.Is(err, flag.ErrHelp) {
+			log.Fatalf("import-users: %v", err)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	LoadData(cfg)
+	persister = newStatePersister(cfg.PersistInterval)
+	persister.Start()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv := RegisterHandlers(cfg)
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("server listening on %s", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && err != http.ErrServerClosed {
+			shutdownStorage()
+			log.Fatalf("server error: %v", err)
+		}
+	case <-ctx.Done():
+		stop()
+		log.Printf("shutting down, waiting up to %s for in-flight requests", cfg.ShutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		// stops accepting connections and waits for running handlers, including LLM calls
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown deadline exceeded: %v", err)
+		}
+	}
+	shutdownStorage()
+	log.Printf("server stopped")
+}
+
+// shutdownStorage writes the final state snapshot and closes the store.
+func shutdownStorage() {
+	if err := persister.Stop(); err != nil {
+		log.Printf("final state flush failed: %v", err)
+	}
+	if err := dataStore.Close(); err != nil {
+		log.Printf("failed to close store: %v", err)
 	}
 }
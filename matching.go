@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// -------- Answer matching --------
+
+const (
+	matchExact         = "exact"          // equal after normalization (default)
+	matchCaseSensitive = "case_sensitive" // like exact, but without lowercasing
+	matchRegex         = "regex"          // accepted answers are patterns matched against the whole answer
+	matchNumeric       = "numeric"        // numbers equal within Tolerance
+	matchSet           = "set"            // unordered list split by SetSeparator
+	matchFuzzy         = "fuzzy"          // edit distance up to MaxDistance
+)
+
+const defaultSetSeparator = ","
+
+// compiled regex answers, keyed by pattern; filled by validateMatching
+var answerPatterns sync.Map
+
+func (q Question) matchMode() string {
+	if q.MatchMode == "" {
+		return matchExact
+	}
+	return q.MatchMode
+}
+
+// answerMatches reports whether answer is one of the question's accepted
+// answers for username under the question's match mode.
+func answerMatches(q Question, username, answer string) bool {
+	opts := answerNormalization.merge(q.Normalization)
+	if q.matchMode() == matchCaseSensitive {
+		opts = opts.merge(NormalizationOptions{normLowercase: false})
+	}
+	given := normalizeAnswer(answer, opts)
+
+	for _, expected := range q.GetCorrectAnswers(username) {
+		var ok bool
+		switch q.matchMode() {
+		case matchRegex:
+			ok = answerPattern(expected).MatchString(given)
+		case matchNumeric:
+			ok = numbersMatch(given, normalizeAnswer(expected, opts), q.Tolerance)
+		case matchSet:
+			ok = setsMatch(given, normalizeAnswer(expected, opts), q.setSeparator())
+		case matchFuzzy:
+			ok = levenshtein(given, normalizeAnswer(expected, opts)) <= q.MaxDistance
+		default:
+			ok = given == normalizeAnswer(expected, opts)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMatching checks the match settings and compiles regex answers, so
+// a broken pattern is reported when questions are loaded, not mid-event.
+func validateMatching(q Question) error {
+	answers := q.allAnswers()
+	switch q.matchMode() {
+	case matchExact, matchCaseSensitive:
+	case matchRegex:
+		opts := answerNormalization.merge(q.Normalization)
+		for _, pattern := range answers {
+			re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+			if err != nil {
+				return fmt.Errorf("invalid regex %q: %w", pattern, err)
+			}
+			if lit, ok := unnormalizedLiteral(pattern, opts); ok {
+				return fmt.Errorf("regex %q can never match: answers are normalized, write %q as %q", pattern, lit, normalizeAnswer(lit, opts))
+			}
+			answerPatterns.Store(pattern, re)
+		}
+	case matchNumeric:
+		if q.Tolerance < 0 {
+			return errors.New("tolerance must not be negative")
+		}
+		opts := answerNormalization.merge(q.Normalization)
+		for _, answer := range answers {
+			if _, err := parseNumber(normalizeAnswer(answer, opts)); err != nil {
+				return fmt.Errorf("numeric answer %q is not a number", answer)
+			}
+		}
+	case matchSet:
+	case matchFuzzy:
+		if q.MaxDistance < 1 {
+			return errors.New("fuzzy match needs max_distance of at least 1")
+		}
+	default:
+		return fmt.Errorf("unknown match_mode %q", q.MatchMode)
+	}
+
+	// an empty answer, or a pattern or distance that allows one, would accept
+	// an empty submission
+	usernames := []string{""}
+	for username := range q.PerUserAnswers {
+		usernames = append(usernames, username)
+	}
+	for _, username := range usernames {
+		if answerMatches(q, username, "") {
+			return errors.New("an empty answer would be accepted, the question needs a non-empty answer")
+		}
+	}
+	return nil
+}
+
+// allAnswers returns the shared and the per-user answers.
+func (q Question) allAnswers() []string {
+	answers := q.GetCorrectAnswers("")
+	for _, answer := range q.PerUserAnswers {
+		answers = append(answers, answer)
+	}
+	return answers
+}
+
+func (q Question) setSeparator() string {
+	if q.SetSeparator == "" {
+		return defaultSetSeparator
+	}
+	return q.SetSeparator
+}
+
+func answerPattern(pattern string) *regexp.Regexp {
+	if re, ok := answerPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	// validated on load, so this only compiles patterns that are known to be valid
+	re := regexp.MustCompile(`^(?:` + pattern + `)$`)
+	answerPatterns.Store(pattern, re)
+	return re
+}
+
+// unnormalizedLiteral returns a literal of pattern that normalization would
+// change, like "Tehran" or "علي". Patterns are matched against the normalized
+// answer, so such a literal never matches.
+func unnormalizedLiteral(pattern string, opts NormalizationOptions) (string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	var walk func(re *syntax.Regexp) (string, bool)
+	walk = func(re *syntax.Regexp) (string, bool) {
+		if re.Op == syntax.OpLiteral {
+			lit := string(re.Rune)
+			if re.Flags&syntax.FoldCase != 0 {
+				lit = strings.ToLower(lit)
+			}
+			// the pipeline trims, surrounding spaces of a literal are fine
+			if normalizeAnswer(lit, opts) != strings.TrimSpace(lit) {
+				return lit, true
+			}
+		}
+		for _, sub := range re.Sub {
+			if lit, ok := walk(sub); ok {
+				return lit, true
+			}
+		}
+		return "", false
+	}
+	return walk(re)
+}
+
+// thousands matches numbers grouped with commas, like 1,250,000.5
+var thousands = regexp.MustCompile(`^[+-]?\d{1,3}(,\d{3})+(\.\d*)?$`)
+
+// parseNumber accepts ASCII digits (Persian digits are folded by normalization),
+// the Persian decimal and thousands separators, and commas: grouping thousands
+// in 1,250 and as a decimal point in 3,14, the way many Persian keyboards type it.
+func parseNumber(s string) (float64, error) {
+	s = strings.NewReplacer("٫", ".", "٬", "", "،", ",", " ", "").Replace(s)
+	switch {
+	case thousands.MatchString(s):
+		s = strings.ReplaceAll(s, ",", "")
+	case strings.Count(s, ",") == 1 && !strings.Contains(s, "."):
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func numbersMatch(given, expected string, tolerance float64) bool {
+	a, err := parseNumber(given)
+	if err != nil {
+		return false
+	}
+	b, err := parseNumber(expected)
+	if err != nil {
+		return false
+	}
+	return math.Abs(a-b) <= tolerance
+}
+
+func setsMatch(given, expected, sep string) bool {
+	a, b := splitSet(given, sep), splitSet(expected, sep)
+	if len(a) != len(b) {
+		return false
+	}
+	for item := range a {
+		if !b[item] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitSet splits on sep and on the Persian comma, ignoring empty and duplicate items.
+func splitSet(s, sep string) map[string]bool {
+	s = strings.ReplaceAll(s, "،", sep)
+	items := map[string]bool{}
+	for _, item := range strings.Split(s, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items[item] = true
+		}
+	}
+	return items
+}
+
+// levenshtein is the edit distance between a and b counted in runes.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
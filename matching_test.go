@@ -0,0 +1,187 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnswerMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		q      Question
+		user   string
+		answer string
+		want   bool
+	}{
+		{"exact", Question{Answer: "تهران"}, "a", "تهران", true},
+		{"exact after normalization", Question{Answer: "علی"}, "a", " علي ", true},
+		{"exact wrong", Question{Answer: "تهران"}, "a", "شیراز", false},
+		{"exact ignores case", Question{Answer: "Tehran"}, "a", "TEHRAN", true},
+		{"accepted answers", Question{Answer: "تهران", AcceptedAnswers: []string{"Tehran"}}, "a", "tehran", true},
+		{"accepted answers without answer", Question{AcceptedAnswers: []string{"x", "y"}}, "a", "y", true},
+		{"empty answer is not accepted next to accepted answers", Question{AcceptedAnswers: []string{"x"}}, "a", "", false},
+		{"per-user answer", Question{Answer: "x", PerUserAnswers: map[string]string{"a": "y"}}, "a", "y", true},
+		{"per-user answer replaces the shared one", Question{Answer: "x", PerUserAnswers: map[string]string{"a": "y"}}, "a", "x", false},
+		{"per-user answer of someone else", Question{Answer: "x", PerUserAnswers: map[string]string{"a": "y"}}, "b", "x", true},
+
+		{"case sensitive", Question{Answer: "Tehran", MatchMode: matchCaseSensitive}, "a", "Tehran", true},
+		{"case sensitive wrong case", Question{Answer: "Tehran", MatchMode: matchCaseSensitive}, "a", "tehran", false},
+
+		{"regex", Question{Answer: `(سال )?1403`, MatchMode: matchRegex}, "a", "سال ۱۴۰۳", true},
+		{"regex whole answer", Question{Answer: `140`, MatchMode: matchRegex}, "a", "1403", false},
+		{"regex sees the lowercased answer", Question{Answer: `tehran|shiraz`, MatchMode: matchRegex}, "a", "Shiraz", true},
+		{"regex with (?i)", Question{Answer: `(?i)Tehran`, MatchMode: matchRegex}, "a", "TEHRAN", true},
+		{"regex sees persian forms", Question{Answer: `علی.*`, MatchMode: matchRegex}, "a", "علي رضا", true},
+
+		{"numeric", Question{Answer: "3.14", MatchMode: matchNumeric, Tolerance: 0.01}, "a", "3.141", true},
+		{"numeric out of tolerance", Question{Answer: "3.14", MatchMode: matchNumeric, Tolerance: 0.01}, "a", "3.2", false},
+		{"numeric persian digits and separator", Question{Answer: "3.14", MatchMode: matchNumeric}, "a", "۳٫۱۴", true},
+		{"numeric decimal comma", Question{Answer: "3.14", MatchMode: matchNumeric}, "a", "3,14", true},
+		{"numeric thousands", Question{Answer: "1250000", MatchMode: matchNumeric}, "a", "1,250,000", true},
+		{"numeric not a number", Question{Answer: "3", MatchMode: matchNumeric}, "a", "three", false},
+
+		{"set", Question{Answer: "a,b,c", MatchMode: matchSet}, "u", "c, a ,b", true},
+		{"set persian comma", Question{Answer: "الف,ب", MatchMode: matchSet}, "u", "ب، الف", true},
+		{"set missing item", Question{Answer: "a,b,c", MatchMode: matchSet}, "u", "a,b", false},
+		{"set custom separator", Question{Answer: "a;b", MatchMode: matchSet, SetSeparator: ";"}, "u", "b;a", true},
+
+		{"fuzzy", Question{Answer: "اصفهان", MatchMode: matchFuzzy, MaxDistance: 1}, "a", "اسفهان", true},
+		{"fuzzy too far", Question{Answer: "اصفهان", MatchMode: matchFuzzy, MaxDistance: 1}, "a", "اسفهام", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMatching(tt.q); err != nil {
+				t.Fatalf("validateMatching: %v", err)
+			}
+			if got := answerMatches(tt.q, tt.user, tt.answer); got != tt.want {
+				t.Errorf("answerMatches(%q) = %t, want %t", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateMatching(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       Question
+		wantErr string
+	}{
+		{"exact", Question{Answer: "x"}, ""},
+		{"unknown mode", Question{Answer: "x", MatchMode: "soundex"}, "unknown match_mode"},
+		{"invalid regex", Question{Answer: "(", MatchMode: matchRegex}, "invalid regex"},
+		{"regex with capitals", Question{Answer: "Tehran", MatchMode: matchRegex}, `write "Tehran" as "tehran"`},
+		{"regex with arabic yeh", Question{Answer: "علي|حسن", MatchMode: matchRegex}, "can never match"},
+		{"regex with persian digits", Question{Answer: `۱۲\d`, MatchMode: matchRegex}, "can never match"},
+		{"regex with spaced affix", Question{Answer: `می خواهم`, MatchMode: matchRegex}, "can never match"},
+		{"regex with escaped classes", Question{Answer: `\D+\S*\W?`, MatchMode: matchRegex}, ""},
+		{"regex with capitals and (?i)", Question{Answer: `(?i)Tehran`, MatchMode: matchRegex}, ""},
+		{"regex capitals without lowercasing", Question{Answer: "Tehran", MatchMode: matchRegex, Normalization: NormalizationOptions{normLowercase: false}}, ""},
+		{"regex per-user answer", Question{Answer: "x", MatchMode: matchRegex, PerUserAnswers: map[string]string{"a": "X"}}, "can never match"},
+		{"numeric", Question{Answer: "1,250", MatchMode: matchNumeric}, ""},
+		{"numeric not a number", Question{Answer: "pi", MatchMode: matchNumeric}, "not a number"},
+		{"negative tolerance", Question{Answer: "1", MatchMode: matchNumeric, Tolerance: -1}, "tolerance"},
+		{"fuzzy without distance", Question{Answer: "x", MatchMode: matchFuzzy}, "max_distance"},
+		{"no answer", Question{}, "non-empty answer"},
+		{"blank answer", Question{Answer: "  "}, "non-empty answer"},
+		{"empty accepted answer", Question{Answer: "x", AcceptedAnswers: []string{""}}, "non-empty answer"},
+		{"accepted answers only", Question{AcceptedAnswers: []string{"x"}}, ""},
+		{"empty per-user answer", Question{Answer: "x", PerUserAnswers: map[string]string{"a": ""}}, "non-empty answer"},
+		{"regex matching nothing", Question{Answer: "x*", MatchMode: matchRegex}, "non-empty answer"},
+		{"empty set", Question{Answer: ", ,", MatchMode: matchSet}, "non-empty answer"},
+		{"fuzzy within distance of nothing", Question{Answer: "ab", MatchMode: matchFuzzy, MaxDistance: 2}, "non-empty answer"},
+		{"fuzzy", Question{Answer: "abc", MatchMode: matchFuzzy, MaxDistance: 2}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMatching(tt.q)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{in: "42", want: 42},
+		{in: "-3.5", want: -3.5},
+		{in: "3٫14", want: 3.14},
+		{in: "3,14", want: 3.14},
+		{in: "3،14", want: 3.14},
+		{in: "1,250", want: 1250},
+		{in: "1,250,000.5", want: 1250000.5},
+		{in: "1٬250", want: 1250},
+		{in: "1 250", want: 1250},
+		{in: "12,50,00", wantErr: true},
+		{in: "1,2.5", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseNumber(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseNumber(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseNumber(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestSetsMatch(t *testing.T) {
+	tests := []struct {
+		given, expected, sep string
+		want                 bool
+	}{
+		{"a,b", "b,a", ",", true},
+		{"a,a,b", "a,b", ",", true},
+		{"a,,b,", "a,b", ",", true},
+		{"a", "a,b", ",", false},
+		{"a,b,c", "a,b", ",", false},
+		{"a،b", "a,b", ",", true},
+		{"a - b", "b-a", "-", true},
+		{"", "", ",", true},
+	}
+	for _, tt := range tests {
+		if got := setsMatch(tt.given, tt.expected, tt.sep); got != tt.want {
+			t.Errorf("setsMatch(%q, %q, %q) = %t, want %t", tt.given, tt.expected, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"kitten", "sitting", 3},
+		{"اصفهان", "اسفهان", 1},
+		{"تهران", "تهرا", 1},
+		{"ab", "ba", 2},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
@@ -6,21 +6,14 @@ import (
 )
 
 const (
-	// configuration
-	jwtSecret               = "replace-with-strong-secret"
-	jwtCookieName           = "Quiz-Token"
-	jwtExpiration           = 24 * time.Hour
-	persistenceStateAbsPath = "./assets/state.json"
-	usersFilePath           = "./assets/users.json"
-	questionsFilePath       = "./assets/questions.json"
-
 	//http server
-	serverAddress = ":8080"
-	claimsKey     = "claims"
+	claimsKey = "claims"
+	// the role from users.json, set by JWTAuthMiddleware
+	roleKey = "role"
 
-	// external API
-	avalaiAPIKey = "aa-Kjck4mY1yilINKUwlmzl8uB0qbyqpWOZWigPMvJEPuhSgbAJ"
-	avalaiAPIURL = "https://api.avalai.ir/v1/chat/completions"
+	// user roles
+	roleContestant = "contestant"
+	roleAdmin      = "admin"
 )
 
 // System prompt mapping
@@ -32,7 +25,13 @@ var systemPrompts = map[int]string{
 var (
 	// loaded data
 	usersByUsername = map[string]User{}
-	questionsByID   = map[int]Question{}
+
+	// questions can be edited by admins while the event runs, read them
+	// through getQuestion/snapshotQuestions
+	questionsByID = map[int]Question{}
+	questionsMu   sync.RWMutex
+	// serialises admin edits, held across read-modify-persist-swap
+	questionsEditMu sync.Mutex
 
 	// in-memory mutable state
 	state   = &InMemoryState{Users: map[string]*UserState{}}
@@ -42,6 +41,23 @@ var (
 type User struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Role     string `json:"role,omitempty"`
+}
+
+// GetRole returns the user's role, contestants are the default.
+func (u User) GetRole() string {
+	if u.Role == "" {
+		return roleContestant
+	}
+	return u.Role
+}
+
+func (u User) IsAdmin() bool {
+	return u.GetRole() == roleAdmin
+}
+
+func validRole(role string) bool {
+	return role == "" || role == roleContestant || role == roleAdmin
 }
 
 type Question struct {
@@ -51,15 +67,41 @@ type Question struct {
 	Penalty         int               `json:"penalty"`
 	PenaltyTryCount int               `json:"penalty_try_count"`
 	PerUserAnswers  map[string]string `json:"per_user_answers"`
-}
-
-func (q Question) GetCorrectAnswer(username string) string {
-	answer, ok := q.PerUserAnswers[username]
-	if ok {
-		return answer
+	Disabled        bool              `json:"disabled,omitempty"`
+	// overrides of the global answer normalization steps for this question
+	Normalization NormalizationOptions `json:"normalization,omitempty"`
+	// answers accepted besides Answer, and how submissions are compared to them
+	AcceptedAnswers []string `json:"accepted_answers,omitempty"`
+	MatchMode       string   `json:"match_mode,omitempty"`
+	Tolerance       float64  `json:"tolerance,omitempty"`     // numeric
+	SetSeparator    string   `json:"set_separator,omitempty"` // set, defaults to ","
+	MaxDistance     int      `json:"max_distance,omitempty"`  // fuzzy
+	// questions that must be solved before this one unlocks
+	Prerequisites []int `json:"prerequisites,omitempty"`
+	// revealed one at a time, in order
+	Hints []Hint `json:"hints,omitempty"`
+	// how Score is awarded, nil is a static Score
+	Scoring *ScoringPolicy `json:"scoring,omitempty"`
+	// what wrong answers cost, nil is Penalty every PenaltyTryCount wrong answers
+	PenaltyPolicy *PenaltyPolicy `json:"penalty_policy,omitempty"`
+}
+
+type Hint struct {
+	Text string `json:"text"`
+	Cost int    `json:"cost"`
+}
+
+// GetCorrectAnswers returns the answers accepted from username. A per-user
+// answer replaces the shared ones.
+func (q Question) GetCorrectAnswers(username string) []string {
+	if answer, ok := q.PerUserAnswers[username]; ok {
+		return []string{answer}
 	}
-	return q.Answer
-
+	answers := make([]string, 0, len(q.AcceptedAnswers)+1)
+	if q.Answer != "" || len(q.AcceptedAnswers) == 0 {
+		answers = append(answers, q.Answer)
+	}
+	return append(answers, q.AcceptedAnswers...)
 }
 
 type AttemptRecord struct {
@@ -67,6 +109,8 @@ type AttemptRecord struct {
 	Answer     string    `json:"answer"`
 	Correct    bool      `json:"correct"`
 	At         time.Time `json:"at"`
+	// what the attempt added to the total score, penalties are negative
+	Score int `json:"score,omitempty"`
 }
 
 type AttemptRecords []AttemptRecord
@@ -76,6 +120,21 @@ type PromptRecords []PromptRecord
 type UserQuestionState struct {
 	AttemptHistory AttemptRecords `json:"attempt_history"`
 	PromptHistory  PromptRecords  `json:"prompt_history"`
+	HintReveals    []HintReveal   `json:"hint_reveals,omitempty"`
+	// times submissions were throttled, one entry per burst of rejections
+	RateLimits []RateLimitRecord `json:"rate_limits,omitempty"`
+}
+
+type RateLimitRecord struct {
+	At                time.Time `json:"at"`
+	RetryAfterSeconds int       `json:"retry_after_seconds"`
+}
+
+// HintReveal records a revealed hint and the cost charged for it.
+type HintReveal struct {
+	Index int       `json:"index"`
+	Cost  int       `json:"cost"`
+	At    time.Time `json:"at"`
 }
 
 type PromptRecord struct {
@@ -109,6 +168,39 @@ type UserState struct {
 type InMemoryState struct {
 	// username -> state
 	Users map[string]*UserState `json:"users"`
+	// sequence number of the last journal entry contained in this state
+	JournalSeq int64 `json:"journal_seq"`
+	// teams whose live results are shown on the frozen scoreboard
+	Revealed map[string]bool `json:"revealed,omitempty"`
+	// set once the whole scoreboard was unfrozen
+	Unfrozen bool `json:"unfrozen,omitempty"`
+	// oldest first, IDs count up from 1
+	Announcements  []Announcement  `json:"announcements,omitempty"`
+	Clarifications []Clarification `json:"clarifications,omitempty"`
+}
+
+// Announcement is a message from the organisers to every team.
+type Announcement struct {
+	ID int `json:"id"`
+	// 0 for announcements not about a single question
+	QuestionID int       `json:"question_id,omitempty"`
+	Text       string    `json:"text"`
+	Author     string    `json:"author"`
+	At         time.Time `json:"at"`
+}
+
+// Clarification is a team's question about a question and the organisers'
+// reply. A public reply is shown to every team, without who asked.
+type Clarification struct {
+	ID         int        `json:"id"`
+	Username   string     `json:"username,omitempty"`
+	QuestionID int        `json:"question_id"`
+	Text       string     `json:"text"`
+	At         time.Time  `json:"at"`
+	Reply      string     `json:"reply,omitempty"`
+	Public     bool       `json:"public"`
+	RepliedBy  string     `json:"replied_by,omitempty"`
+	RepliedAt  *time.Time `json:"replied_at,omitempty"`
 }
 
 type submitAnswerRequest struct {
@@ -119,31 +211,16 @@ type submitAnswerRequest struct {
 type promptRequest struct {
 	UserPrompt     string `json:"user_prompt"`
 	SystemPromptID int    `json:"system_prompt_id"`
+	// optional, defaults to the question after the last solved one
+	QuestionID int `json:"question_id,omitempty"`
+	// answer with server-sent events as the tokens arrive
+	Stream bool `json:"stream,omitempty"`
 }
 
 type promptResponse struct {
 	Result string `json:"result"`
 }
 
-// External API request/response structures
-type avalaiMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type avalaiRequest struct {
-	Model    string          `json:"model"`
-	Messages []avalaiMessage `json:"messages"`
-}
-
-type avalaiChoice struct {
-	Message avalaiMessage `json:"message"`
-}
-
-type avalaiResponse struct {
-	Choices []avalaiChoice `json:"choices"`
-}
-
 // Response structures for getUserAll API
 type SolvedQuestion struct {
 	QuestionID int       `json:"question_id"`
@@ -152,11 +229,19 @@ type SolvedQuestion struct {
 }
 
 type UserAllInfo struct {
-	Username       string          `json:"username"`
-	TotalScore     int             `json:"total_score"`
+	Rank            int              `json:"rank"`
+	Username        string           `json:"username"`
+	TotalScore      int              `json:"total_score"`
+	HintCost        int              `json:"hint_cost"` // already deducted from TotalScore
+	LastGainAt      *time.Time       `json:"last_gain_at,omitempty"`
+	WrongAttempts   int              `json:"wrong_attempts"`
 	SolvedQuestions []SolvedQuestion `json:"solved_questions"`
 }
 
 type GetAllUsersResponse struct {
 	Users []UserAllInfo `json:"users"`
+	// number of ranked users, before pagination
+	Total int `json:"total"`
+	// results after the freeze are hidden, except for revealed teams
+	Frozen bool `json:"frozen"`
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// -------- Answer normalization --------
+
+// Normalization steps, applied in this order to both the submitted and the
+// expected answer before they are compared.
+const (
+	normNFC          = "nfc"           // Unicode NFC composition
+	normPersianChars = "persian_chars" // Arabic ي/ى/ك/ة/ۀ/أ/إ to their Persian forms
+	normDigits       = "digits"        // Persian and Arabic-Indic digits to 0-9
+	normDiacritics   = "diacritics"    // drop harakat, tanwin, superscript alef
+	normTatweel      = "tatweel"       // drop kashida ـ
+	normLowercase    = "lowercase"
+	normPunctuation  = "punctuation" // drop punctuation, including ، ؛ ؟ « »
+	normZWNJ         = "zwnj"        // drop ZWNJ/ZWJ and bidi marks, join می/نمی and ها/های to their word
+	normWhitespace   = "whitespace"  // collapse runs of whitespace to one space
+)
+
+var normalizationSteps = []string{
+	normNFC,
+	normPersianChars,
+	normDigits,
+	normDiacritics,
+	normTatweel,
+	normLowercase,
+	normPunctuation,
+	normZWNJ,
+	normWhitespace,
+}
+
+// NormalizationOptions switches steps on or off by name. Questions only list
+// the steps they want to change, everything else follows the global options.
+type NormalizationOptions map[string]bool
+
+func defaultNormalizationOptions() NormalizationOptions {
+	opts := NormalizationOptions{}
+	for _, step := range normalizationSteps {
+		opts[step] = true
+	}
+	// answers may legitimately contain punctuation, questions opt in
+	opts[normPunctuation] = false
+	return opts
+}
+
+// answerNormalization is the global pipeline, set from the config at startup.
+var answerNormalization = defaultNormalizationOptions()
+
+func (o NormalizationOptions) Validate() error {
+	for step := range o {
+		if !isNormalizationStep(step) {
+			return fmt.Errorf("unknown normalization step %q", step)
+		}
+	}
+	return nil
+}
+
+// merge returns o with the steps set in override replaced.
+func (o NormalizationOptions) merge(override NormalizationOptions) NormalizationOptions {
+	if len(override) == 0 {
+		return o
+	}
+	out := make(NormalizationOptions, len(o))
+	for step, on := range o {
+		out[step] = on
+	}
+	for step, on := range override {
+		out[step] = on
+	}
+	return out
+}
+
+func isNormalizationStep(step string) bool {
+	for _, s := range normalizationSteps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+var persianCharReplacer = strings.NewReplacer(
+	"\u064a", "\u06cc", // ي arabic yeh -> ی
+	"\u0649", "\u06cc", // ى alef maksura -> ی
+	"\u0643", "\u06a9", // ك arabic kaf -> ک
+	"\u0629", "\u0647", // ة teh marbuta -> ه
+	"\u06c0", "\u0647", // ۀ heh with yeh -> ه
+	"\u0623", "\u0627", // أ alef with hamza above -> ا
+	"\u0625", "\u0627", // إ alef with hamza below -> ا
+	"\u0671", "\u0627", // ٱ alef wasla -> ا
+)
+
+// a space people type where the half-space (ZWNJ) belongs
+var (
+	persianPrefixSpace = regexp.MustCompile(`(^|\s)(ن?می)\s+`)
+	persianSuffixSpace = regexp.MustCompile(`\s+(ها|های|هایی)(\s|$)`)
+)
+
+// normalizeAnswer runs the enabled steps over s. Leading and trailing
+// whitespace is always trimmed.
+func normalizeAnswer(s string, opts NormalizationOptions) string {
+	if opts[normNFC] {
+		s = norm.NFC.String(s)
+	}
+	if opts[normPersianChars] {
+		s = persianCharReplacer.Replace(s)
+	}
+	if opts[normDigits] {
+		s = strings.Map(foldDigit, s)
+	}
+	if opts[normDiacritics] {
+		s = strings.Map(func(r rune) rune {
+			if isArabicDiacritic(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	if opts[normTatweel] {
+		s = strings.ReplaceAll(s, "\u0640", "")
+	}
+	if opts[normLowercase] {
+		s = strings.ToLower(s)
+	}
+	if opts[normPunctuation] {
+		s = strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	if opts[normZWNJ] {
+		s = strings.Map(func(r rune) rune {
+			switch r {
+			case '\u200c', '\u200d', // ZWNJ, ZWJ
+				'\u200e', '\u200f', '\u202a', '\u202b', '\u202c', '\u202d', '\u202e': // bidi marks
+				return -1
+			}
+			return r
+		}, s)
+		// "می خواهم" is typed for "می‌خواهم" as often as "میخواهم"
+		s = persianPrefixSpace.ReplaceAllString(s, "$1$2")
+		s = persianSuffixSpace.ReplaceAllString(s, "$1$2")
+	}
+	if opts[normWhitespace] {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	return strings.TrimSpace(s)
+}
+
+// foldDigit maps Persian (۰-۹) and Arabic-Indic (٠-٩) digits to ASCII.
+func foldDigit(r rune) rune {
+	switch {
+	case r >= '\u06f0' && r <= '\u06f9':
+		return '0' + (r - '\u06f0')
+	case r >= '\u0660' && r <= '\u0669':
+		return '0' + (r - '\u0660')
+	}
+	return r
+}
+
+func isArabicDiacritic(r rune) bool {
+	return (r >= '\u064b' && r <= '\u065f') || r == '\u0670' || (r >= '\u0610' && r <= '\u061a')
+}
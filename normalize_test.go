@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+func TestNormalizeAnswer(t *testing.T) {
+	defaults := defaultNormalizationOptions()
+	only := func(steps ...string) NormalizationOptions {
+		opts := NormalizationOptions{}
+		for _, step := range steps {
+			opts[step] = true
+		}
+		return opts
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		opts NormalizationOptions
+		want string
+	}{
+		{"trims without any step", "  سلام  ", NormalizationOptions{}, "سلام"},
+		{"arabic yeh and kaf", "كتاب علي", defaults, "کتاب علی"},
+		{"teh marbuta and alef hamza", "مدرسة أحمد إيران", defaults, "مدرسه احمد ایران"},
+		{"persian digits", "۱۴۰۳", defaults, "1403"},
+		{"arabic-indic digits", "٣٫١٤", defaults, "3٫14"},
+		{"diacritics", "کِتابٌ", defaults, "کتاب"},
+		{"tatweel", "کـــتاب", defaults, "کتاب"},
+		{"lowercase", "Tehran", defaults, "tehran"},
+		{"punctuation is kept by default", "«سلام»!", defaults, "«سلام»!"},
+		{"punctuation when enabled", "«سلام»، دنیا!", defaults.merge(only(normPunctuation)), "سلام دنیا"},
+		{"whitespace", "سلام \t  دنیا", defaults, "سلام دنیا"},
+		{"bidi marks", "\u200fسلام\u200e", defaults, "سلام"},
+		{"zwnj is dropped", "می\u200cخواهم", defaults, "میخواهم"},
+		{"zwj is dropped", "می\u200dخواهم", defaults, "میخواهم"},
+		{"space after می", "می خواهم", defaults, "میخواهم"},
+		{"space after نمی", "نمی  دانم", defaults, "نمیدانم"},
+		{"می inside a sentence", "من می خواهم بروم", defaults, "من میخواهم بروم"},
+		{"space before ها", "کتاب ها", defaults, "کتابها"},
+		{"space before های", "کتاب های من", defaults, "کتابهای من"},
+		{"ها with zwnj", "کتاب‌ها", defaults, "کتابها"},
+		{"words starting with می are left alone", "میز بزرگ", defaults, "میز بزرگ"},
+		{"words starting with ها are left alone", "آب هامون", defaults, "آب هامون"},
+		{"zwnj step off keeps it", "می‌خواهم", defaults.merge(NormalizationOptions{normZWNJ: false}), "می‌خواهم"},
+		{"lowercase off", "Tehran", defaults.merge(NormalizationOptions{normLowercase: false}), "Tehran"},
+		{"nfc", "e\u0301", only(normNFC), "\u00e9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeAnswer(tt.in, tt.opts); got != tt.want {
+				t.Errorf("normalizeAnswer(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAnswerHalfSpaceSpellings(t *testing.T) {
+	opts := defaultNormalizationOptions()
+	spellings := [][]string{
+		{"می‌خواهم", "میخواهم", "می خواهم"},
+		{"نمی‌دانم", "نمیدانم", "نمی دانم"},
+		{"کتاب‌ها", "کتابها", "کتاب ها"},
+		{"درخت‌های سبز", "درختهای سبز", "درخت های سبز"},
+	}
+	for _, group := range spellings {
+		want := normalizeAnswer(group[0], opts)
+		for _, s := range group[1:] {
+			if got := normalizeAnswer(s, opts); got != want {
+				t.Errorf("normalizeAnswer(%q) = %q, want %q like %q", s, got, want, group[0])
+			}
+		}
+	}
+}
+
+func TestNormalizationOptions(t *testing.T) {
+	if err := (NormalizationOptions{normDigits: false}).Validate(); err != nil {
+		t.Errorf("valid options: %v", err)
+	}
+	if err := (NormalizationOptions{"stemming": true}).Validate(); err == nil {
+		t.Error("unknown step accepted")
+	}
+
+	base := defaultNormalizationOptions()
+	merged := base.merge(NormalizationOptions{normDigits: false})
+	if merged[normDigits] || !base[normDigits] {
+		t.Errorf("merge: got digits %t in merged and %t in base, want false and true", merged[normDigits], base[normDigits])
+	}
+	if !merged[normLowercase] {
+		t.Error("merge dropped a step it did not override")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// -------- Password hashing --------
+
+const (
+	argon2idPrefix = "$argon2id$"
+
+	generatedPasswordAlphabet = "abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	errPlaintextPassword = errors.New("plaintext password")
+
+	// hash compared against when the username is unknown, so a missing user
+	// costs the same time as a wrong password
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// isPasswordHash reports whether stored looks like a bcrypt or argon2id hash.
+func isPasswordHash(stored string) bool {
+	return isBcryptHash(stored) || strings.HasPrefix(stored, argon2idPrefix)
+}
+
+func isBcryptHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+// verifyPassword checks password against the stored value from users.json.
+// Plaintext values only match when allowPlaintext is set.
+func verifyPassword(stored, password string, allowPlaintext bool) bool {
+	switch {
+	case isBcryptHash(stored):
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	case strings.HasPrefix(stored, argon2idPrefix):
+		ok, err := verifyArgon2id(stored, password)
+		return err == nil && ok
+	case allowPlaintext:
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	default:
+		return false
+	}
+}
+
+// burnPasswordCheck spends roughly the time of a real bcrypt comparison.
+func burnPasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// verifyArgon2id checks a PHC formatted hash:
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func verifyArgon2id(encoded, password string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, errors.New("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, err
+	}
+	if version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, err
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, err
+	}
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+func generatePassword(length int) (string, error) {
+	max := big.NewInt(int64(len(generatedPasswordAlphabet)))
+	var sb strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(generatedPasswordAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
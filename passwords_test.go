@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idHash encodes password the way verifyArgon2id expects.
+func argon2idHash(password string) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, 1, 64*1024, 2, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 64*1024, 1, 2,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestVerifyPassword(t *testing.T) {
+	bcryptHash, err := hashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHash := argon2idHash("secret")
+
+	tests := []struct {
+		name           string
+		stored         string
+		password       string
+		allowPlaintext bool
+		want           bool
+	}{
+		{"bcrypt", bcryptHash, "secret", false, true},
+		{"bcrypt wrong", bcryptHash, "Secret", false, false},
+		{"argon2id", argonHash, "secret", false, true},
+		{"argon2id wrong", argonHash, "secret ", false, false},
+		{"argon2id malformed", "$argon2id$v=19$m=65536", "secret", false, false},
+		{"plaintext refused", "secret", "secret", false, false},
+		{"plaintext allowed", "secret", "secret", true, true},
+		{"plaintext allowed wrong", "secret", "other", true, false},
+		// a hash is never compared as plaintext
+		{"hash as password", bcryptHash, bcryptHash, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPassword(tt.stored, tt.password, tt.allowPlaintext); got != tt.want {
+				t.Errorf("verifyPassword = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
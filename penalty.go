@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// -------- Penalties --------
+
+const (
+	penaltyNone       = "none"
+	penaltyEveryN     = "every_n"    // Penalty on every penalty_try_count-th wrong attempt (default)
+	penaltyEscalating = "escalating" // Penalty, then Step more for every further wrong attempt
+)
+
+// PenaltyPolicy decides what a wrong answer costs. A question without one
+// uses every_n with its penalty_try_count, where 0 and 1 both mean every
+// wrong attempt.
+type PenaltyPolicy struct {
+	Policy string `json:"policy,omitempty"`
+	Step   int    `json:"step,omitempty"` // escalating
+	// cap on the total penalty per question and user, 0 is no cap
+	Max int `json:"max,omitempty"`
+	// lock the question for LockoutSeconds after every LockoutAfter-th wrong attempt
+	LockoutAfter   int `json:"lockout_after,omitempty"`
+	LockoutSeconds int `json:"lockout_seconds,omitempty"`
+}
+
+func (q Question) penaltyPolicy() PenaltyPolicy {
+	if q.PenaltyPolicy == nil {
+		return PenaltyPolicy{Policy: penaltyEveryN}
+	}
+	return *q.PenaltyPolicy
+}
+
+// wrongAnswerPenalty is what the next wrong answer costs after prior. The cap
+// counts what the policy charged for the earlier wrong answers, so attempts
+// stored before they carried their score count as well.
+func (q Question) wrongAnswerPenalty(prior AttemptRecords) int {
+	p := q.penaltyPolicy()
+	wrongAttempts := q.acceptedAttempts(prior).CountByCorrectnessState(false) + 1
+
+	penalty := q.nthWrongPenalty(p, wrongAttempts)
+	if p.Max > 0 {
+		charged := 0
+		for n := 1; n < wrongAttempts && charged < p.Max; n++ {
+			charged += q.nthWrongPenalty(p, n)
+		}
+		penalty = min(penalty, max(p.Max-charged, 0))
+	}
+	return penalty
+}
+
+// nthWrongPenalty is what the n-th wrong answer costs before the cap.
+func (q Question) nthWrongPenalty(p PenaltyPolicy, n int) int {
+	switch p.Policy {
+	case penaltyNone:
+		return 0
+	case penaltyEscalating:
+		return q.Penalty + (n-1)*p.Step
+	default:
+		if n%max(q.PenaltyTryCount, 1) == 0 {
+			return q.Penalty
+		}
+		return 0
+	}
+}
+
+// acceptedAttempts drops the attempts made while a lockout was in force.
+// Live submissions are rejected then and never stored, but a rescore under a
+// new policy replays attempts a lockout would have rejected.
+func (q Question) acceptedAttempts(attempts AttemptRecords) AttemptRecords {
+	p := q.penaltyPolicy()
+	if p.LockoutAfter == 0 {
+		return attempts
+	}
+	accepted := make(AttemptRecords, 0, len(attempts))
+	var until time.Time
+	wrong := 0
+	for _, attempt := range attempts {
+		if attempt.At.Before(until) {
+			continue
+		}
+		accepted = append(accepted, attempt)
+		if !attempt.Correct {
+			wrong++
+			if wrong%p.LockoutAfter == 0 {
+				until = attempt.At.Add(time.Duration(p.LockoutSeconds) * time.Second)
+			}
+		}
+	}
+	return accepted
+}
+
+// lockedUntil returns when a lockout caused by attempts ends, the zero time
+// if there is none.
+func (q Question) lockedUntil(attempts AttemptRecords) time.Time {
+	p := q.penaltyPolicy()
+	attempts = q.acceptedAttempts(attempts)
+	if p.LockoutAfter == 0 || attempts.Solved() {
+		return time.Time{}
+	}
+	wrongAttempts := attempts.CountByCorrectnessState(false)
+	if wrongAttempts == 0 || wrongAttempts%p.LockoutAfter != 0 {
+		return time.Time{}
+	}
+	last := attempts[len(attempts)-1]
+	return last.At.Add(time.Duration(p.LockoutSeconds) * time.Second)
+}
+
+// secondsUntil rounds up, so clients never retry a moment too early.
+func secondsUntil(now, t time.Time) int {
+	return int(math.Ceil(t.Sub(now).Seconds()))
+}
+
+func (p *PenaltyPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Policy {
+	case "", penaltyNone, penaltyEveryN, penaltyEscalating:
+	default:
+		return fmt.Errorf("unknown penalty policy %q", p.Policy)
+	}
+	if p.Step < 0 || p.Max < 0 || p.LockoutAfter < 0 || p.LockoutSeconds < 0 {
+		return errors.New("penalty_policy values must not be negative")
+	}
+	if p.LockoutAfter > 0 && p.LockoutSeconds == 0 {
+		return errors.New("penalty_policy.lockout_after needs lockout_seconds")
+	}
+	return nil
+}
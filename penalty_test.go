@@ -0,0 +1,174 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// wrongAttempts returns n wrong attempts a minute apart. Score stays 0 like
+// attempts stored before they carried their points.
+func wrongAttempts(n int) AttemptRecords {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	attempts := make(AttemptRecords, n)
+	for i := range attempts {
+		attempts[i] = AttemptRecord{QuestionID: 1, Answer: "wrong", At: start.Add(time.Duration(i) * time.Minute)}
+	}
+	return attempts
+}
+
+func TestWrongAnswerPenalty(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     Question
+		prior int
+		want  int
+	}{
+		{"legacy every answer", Question{Penalty: 5}, 0, 5},
+		{"legacy try count 1", Question{Penalty: 5, PenaltyTryCount: 1}, 3, 5},
+		{"legacy every third, first", Question{Penalty: 5, PenaltyTryCount: 3}, 0, 0},
+		{"legacy every third, third", Question{Penalty: 5, PenaltyTryCount: 3}, 2, 5},
+		{"legacy every third, fourth", Question{Penalty: 5, PenaltyTryCount: 3}, 3, 0},
+		{"none", Question{Penalty: 5, PenaltyPolicy: &PenaltyPolicy{Policy: penaltyNone}}, 0, 0},
+		{"escalating first", Question{Penalty: 5, PenaltyPolicy: &PenaltyPolicy{Policy: penaltyEscalating, Step: 3}}, 0, 5},
+		{"escalating third", Question{Penalty: 5, PenaltyPolicy: &PenaltyPolicy{Policy: penaltyEscalating, Step: 3}}, 2, 11},
+		{"cap not reached", Question{Penalty: 5, PenaltyPolicy: &PenaltyPolicy{Max: 12}}, 1, 5},
+		{"cap partly reached", Question{Penalty: 5, PenaltyPolicy: &PenaltyPolicy{Max: 12}}, 2, 2},
+		{"cap reached", Question{Penalty: 5, PenaltyPolicy: &PenaltyPolicy{Max: 12}}, 3, 0},
+		{"cap with every third", Question{Penalty: 5, PenaltyTryCount: 3, PenaltyPolicy: &PenaltyPolicy{Max: 8}}, 5, 3},
+		{"escalating capped", Question{Penalty: 5, PenaltyPolicy: &PenaltyPolicy{Policy: penaltyEscalating, Step: 5, Max: 20}}, 2, 5},
+		{"escalating past cap", Question{Penalty: 5, PenaltyPolicy: &PenaltyPolicy{Policy: penaltyEscalating, Step: 5, Max: 20}}, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.wrongAnswerPenalty(wrongAttempts(tt.prior)); got != tt.want {
+				t.Errorf("penalty after %d wrong answers = %d, want %d", tt.prior, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPenaltyCapTotal(t *testing.T) {
+	q := Question{Penalty: 4, PenaltyPolicy: &PenaltyPolicy{Policy: penaltyEscalating, Step: 2, Max: 15}}
+	total := 0
+	for n := 0; n < 10; n++ {
+		total += q.wrongAnswerPenalty(wrongAttempts(n))
+	}
+	if total != 15 {
+		t.Errorf("charged %d over 10 wrong answers, want the cap of 15", total)
+	}
+}
+
+func TestLockedUntil(t *testing.T) {
+	q := Question{PenaltyPolicy: &PenaltyPolicy{LockoutAfter: 3, LockoutSeconds: 300}}
+	attempts := wrongAttempts(3)
+
+	if got := q.lockedUntil(attempts[:2]); !got.IsZero() {
+		t.Errorf("locked after 2 wrong answers until %v", got)
+	}
+	want := attempts[2].At.Add(5 * time.Minute)
+	if got := q.lockedUntil(attempts); !got.Equal(want) {
+		t.Errorf("lockedUntil = %v, want %v", got, want)
+	}
+	solved := append(attempts[:2:2], AttemptRecord{QuestionID: 1, Correct: true, At: attempts[2].At})
+	if got := q.lockedUntil(solved); !got.IsZero() {
+		t.Errorf("locked after solving until %v", got)
+	}
+	if got := (Question{}).lockedUntil(attempts); !got.IsZero() {
+		t.Errorf("locked without a lockout policy until %v", got)
+	}
+}
+
+func TestAcceptedAttempts(t *testing.T) {
+	q := Question{PenaltyPolicy: &PenaltyPolicy{LockoutAfter: 2, LockoutSeconds: 150}}
+	// a minute apart: the first two lock until 3.5, dropping 2 and 3; 4 and 5 lock until 7.5
+	attempts := wrongAttempts(7)
+	got := q.acceptedAttempts(attempts)
+	var minutes []int
+	for _, a := range got {
+		minutes = append(minutes, int(a.At.Sub(attempts[0].At).Minutes()))
+	}
+	want := []int{0, 1, 4, 5}
+	if len(minutes) != len(want) {
+		t.Fatalf("accepted attempts at minutes %v, want %v", minutes, want)
+	}
+	for i := range want {
+		if minutes[i] != want[i] {
+			t.Fatalf("accepted attempts at minutes %v, want %v", minutes, want)
+		}
+	}
+}
+
+func TestEvaluateAttemptDuringLockout(t *testing.T) {
+	q := Question{Answer: "x", Score: 10, Penalty: 1, PenaltyPolicy: &PenaltyPolicy{LockoutAfter: 2, LockoutSeconds: 600}}
+	prior := wrongAttempts(2)
+	during := solveContext{At: prior[1].At.Add(time.Minute)}
+	if got := evaluateAttempt(q, "a", "x", prior, during); got != (attemptOutcome{LockedOut: true}) {
+		t.Errorf("answer during lockout = %+v, want locked out", got)
+	}
+	after := solveContext{At: prior[1].At.Add(11 * time.Minute)}
+	if got := evaluateAttempt(q, "a", "x", prior, after); !got.Correct || got.ScoreDelta != 10 {
+		t.Errorf("answer after lockout = %+v, want correct for 10", got)
+	}
+}
+
+func TestPenaltyPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *PenaltyPolicy
+		wantErr string
+	}{
+		{"nil", nil, ""},
+		{"escalating", &PenaltyPolicy{Policy: penaltyEscalating, Step: 2, Max: 10}, ""},
+		{"unknown", &PenaltyPolicy{Policy: "double"}, "unknown penalty policy"},
+		{"negative step", &PenaltyPolicy{Step: -1}, "must not be negative"},
+		{"lockout without duration", &PenaltyPolicy{LockoutAfter: 3}, "lockout_seconds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplayScoresAppliesPenaltyPolicy(t *testing.T) {
+	history := wrongAttempts(4)
+	history = append(history, AttemptRecord{QuestionID: 1, Answer: "x", At: history[3].At.Add(time.Minute)})
+	// solved first so penalties are not lost to the zero floor
+	earlier := AttemptRecords{{QuestionID: 2, Answer: "y", Correct: true, At: history[0].At.Add(-time.Hour)}}
+	users := map[string]*UserState{
+		"a": {Username: "a", PerQuestion: map[int]*UserQuestionState{
+			1: {AttemptHistory: history},
+			2: {AttemptHistory: earlier},
+		}},
+	}
+
+	tests := []struct {
+		name   string
+		policy *PenaltyPolicy
+		want   int
+	}{
+		{"capped", &PenaltyPolicy{Max: 5}, 200 - 5},
+		{"lockout drops the attempts it would have rejected", &PenaltyPolicy{LockoutAfter: 2, LockoutSeconds: 150}, 200 - 2*2},
+		// the solve at minute 4 falls into the lockout after the wrong answers at 0 and 1
+		{"lockout rejects the solve", &PenaltyPolicy{LockoutAfter: 2, LockoutSeconds: 270}, 100 - 2*2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := Question{ID: 1, Answer: "x", Score: 100, Penalty: 2, PenaltyPolicy: tt.policy}
+			results := replayScores(users, map[int]Question{1: q, 2: {ID: 2, Answer: "y", Score: 100}})
+			if got := results["a"].TotalScore; got != tt.want {
+				t.Errorf("TotalScore = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -------- Background persistence --------
+
+// statePersister writes state snapshots in the background. Handlers only mark
+// the state dirty; the worker coalesces those marks and flushes at most once
+// per interval, plus once more on shutdown. Accepted submissions are already
+// durable through the store's events, snapshots only compact them.
+type statePersister struct {
+	interval time.Duration
+
+	// generation of the last change and of the last successful flush
+	dirtyGen   atomic.Int64
+	flushedGen atomic.Int64
+
+	flushMu sync.Mutex // one flush at a time
+
+	mu          sync.Mutex
+	lastFlushAt time.Time
+	lastErr     error
+	lastErrAt   time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type persistenceHealth struct {
+	OK          bool       `json:"ok"`
+	Pending     bool       `json:"pending"`
+	Interval    string     `json:"interval"`
+	LastFlushAt time.Time  `json:"last_flush_at"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+var persister *statePersister
+
+func newStatePersister(interval time.Duration) *statePersister {
+	return &statePersister{
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (p *statePersister) Start() {
+	go p.loop()
+}
+
+func (p *statePersister) loop() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if p.pending() {
+				p.Flush()
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// MarkDirty records that the state changed since the last flush. It never blocks.
+func (p *statePersister) MarkDirty() {
+	p.dirtyGen.Add(1)
+}
+
+func (p *statePersister) pending() bool {
+	return p.dirtyGen.Load() != p.flushedGen.Load()
+}
+
+// Flush writes a snapshot now, failures are logged and reported by Health.
+func (p *statePersister) Flush() error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	gen := p.dirtyGen.Load()
+	err := persistState()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		log.Printf("failed to persist state: %v", err)
+		p.lastErr = err
+		p.lastErrAt = time.Now()
+		return err
+	}
+	p.flushedGen.Store(gen)
+	p.lastFlushAt = time.Now()
+	p.lastErr = nil
+	return nil
+}
+
+// Stop ends the worker and performs a final flush.
+func (p *statePersister) Stop() error {
+	close(p.stop)
+	<-p.done
+	return p.Flush()
+}
+
+func (p *statePersister) Health() persistenceHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := persistenceHealth{
+		OK:          p.lastErr == nil,
+		Pending:     p.pending(),
+		Interval:    p.interval.String(),
+		LastFlushAt: p.lastFlushAt,
+	}
+	if p.lastErr != nil {
+		h.LastError = p.lastErr.Error()
+		errAt := p.lastErrAt
+		h.LastErrorAt = &errAt
+	}
+	return h
+}
+
+// markStateDirty schedules a snapshot, a no-op until the persister runs.
+func markStateDirty() {
+	if persister != nil {
+		persister.MarkDirty()
+	}
+}
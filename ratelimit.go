@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// -------- Submission rate limiting --------
+
+// rateLimiter is a token bucket per key. Each bucket holds up to burst
+// tokens and gains one every interval. Buckets live in memory only, a
+// restart hands everyone a full bucket.
+type rateLimiter struct {
+	burst    float64
+	interval time.Duration
+
+	mu        sync.Mutex
+	buckets   map[submitKey]*tokenBucket
+	lastPrune time.Time
+}
+
+type submitKey struct {
+	username   string
+	questionID int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// set by the first rejection, cleared by the next allowed request
+	limited bool
+}
+
+func newRateLimiter(burst int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		burst:    float64(burst),
+		interval: interval,
+		buckets:  map[submitKey]*tokenBucket{},
+	}
+}
+
+// Allow takes a token for key. When the bucket is empty it returns how long
+// until the next token and whether this is the first rejection in a row,
+// which is the one worth recording.
+func (l *rateLimiter) Allow(key submitKey, now time.Time) (ok bool, retryAfter time.Duration, first bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(b.tokens+float64(now.Sub(b.last))/float64(l.interval), l.burst)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		return true, 0, false
+	}
+	first = !b.limited
+	b.limited = true
+	return false, time.Duration((1 - b.tokens) * float64(l.interval)), first
+}
+
+// recordRateLimit notes in the user's state that their submissions on
+// questionID were throttled. A failure to store it only gets logged, the
+// request is rejected either way.
+func recordRateLimit(us *UserState, questionID int, at time.Time, retryAfterSeconds int) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	recordEvent(stateEvent{
+		Type:               eventRateLimit,
+		Username:           us.Username,
+		QuestionID:         questionID,
+		RateLimit:          &RateLimitRecord{At: at, RetryAfterSeconds: retryAfterSeconds},
+		TotalScore:         us.TotalScore,
+		LastSolvedQuestion: us.LastSolvedQuestion,
+	})
+}
+
+// prune drops buckets that have refilled completely, they are the same as new ones.
+func (l *rateLimiter) prune(now time.Time) {
+	full := time.Duration(l.burst * float64(l.interval))
+	if now.Sub(l.lastPrune) < full {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
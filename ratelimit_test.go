@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 10*time.Second)
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	key := submitKey{"a", 1}
+
+	tests := []struct {
+		name      string
+		key       submitKey
+		after     time.Duration // since start
+		wantOK    bool
+		wantRetry time.Duration
+		wantFirst bool
+	}{
+		{"burst 1", key, 0, true, 0, false},
+		{"burst 2", key, 0, true, 0, false},
+		{"empty", key, 0, false, 10 * time.Second, true},
+		{"still empty", key, 5 * time.Second, false, 5 * time.Second, false},
+		{"other question", submitKey{"a", 2}, 5 * time.Second, true, 0, false},
+		{"other user", submitKey{"b", 1}, 5 * time.Second, true, 0, false},
+		{"refilled one", key, 10 * time.Second, true, 0, false},
+		{"empty again", key, 10 * time.Second, false, 10 * time.Second, true},
+		// a long pause refills up to the burst, not beyond
+		{"after a pause 1", key, time.Hour, true, 0, false},
+		{"after a pause 2", key, time.Hour, true, 0, false},
+		{"after a pause 3", key, time.Hour, false, 10 * time.Second, true},
+	}
+	for _, tt := range tests {
+		ok, retry, first := l.Allow(tt.key, start.Add(tt.after))
+		if ok != tt.wantOK || retry != tt.wantRetry || first != tt.wantFirst {
+			t.Errorf("%s: Allow = %t, %v, %t; want %t, %v, %t", tt.name, ok, retry, first, tt.wantOK, tt.wantRetry, tt.wantFirst)
+		}
+	}
+}
+
+// serveSubmit runs handler for username with role on question 1.
+func serveSubmit(handler gin.HandlerFunc, username, role, answer string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/submit_answer", strings.NewReader(`{"question_id": 1, "answer": "`+answer+`"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(claimsKey, &Claims{Username: username})
+	c.Set(roleKey, role)
+	handler(c)
+	return w
+}
+
+func TestSubmitAnswerRateLimit(t *testing.T) {
+	store := setupHandlerTest(t, map[int]Question{1: {ID: 1, Answer: "x", Score: 10}})
+	handler := submitAnswerHandler(&Config{SubmitBurst: 1, SubmitInterval: time.Minute})
+
+	if w := serveSubmit(handler, "a", roleContestant, "wrong"); w.Code != http.StatusOK {
+		t.Fatalf("first submission = %d %s", w.Code, w.Body.String())
+	}
+	for i := 0; i < 2; i++ {
+		w := serveSubmit(handler, "a", roleContestant, "x")
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+			t.Fatalf("throttled submission = %d, Retry-After %q; want 429, 60", w.Code, w.Header().Get("Retry-After"))
+		}
+		var resp submitAnswerResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.OK || resp.RetryAfterSeconds != 60 {
+			t.Errorf("response = %+v, want retry_after_seconds 60", resp)
+		}
+	}
+	// the wrong answer and the first rejection, the answer was never checked
+	if len(store.events) != 2 || store.events[1].Type != eventRateLimit {
+		t.Errorf("recorded %d events, want an attempt and one rate limit", len(store.events))
+	}
+	if state.Users["a"].PerQuestion[1].AttemptHistory.Solved() {
+		t.Error("throttled answer was accepted")
+	}
+
+	// other teams and organisers are not affected
+	if w := serveSubmit(handler, "b", roleContestant, "x"); w.Code != http.StatusOK {
+		t.Errorf("other team = %d %s", w.Code, w.Body.String())
+	}
+	for i := 0; i < 3; i++ {
+		if w := serveSubmit(handler, "organiser", roleAdmin, "wrong"); w.Code != http.StatusOK {
+			t.Errorf("organiser submission %d = %d %s", i+1, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// -------- Rescoring --------
+
+// userScore is the result of replaying one user's attempt history.
+type userScore struct {
+	TotalScore         int
+	LastSolvedQuestion int
+	// question id -> re-evaluated attempts, in AttemptHistory order
+	Outcomes map[int][]attemptOutcome
+}
+
+type replayEvent struct {
+	username   string
+	questionID int
+	index      int
+	at         time.Time
+	// a hint reveal instead of an attempt, it is charged what it cost when revealed
+	hint     bool
+	hintCost int
+}
+
+// replayScores recomputes every user's score from their attempt histories
+// against the given questions. Attempts are replayed in global chronological
+// order so the result only depends on the stored history. Attempts on
+// questions that no longer exist keep their recorded correctness and score
+// nothing. Hint reveals are replayed in the same order so the zero floor of
+// the total score applies exactly as it did live, and solve counts for
+// dynamic scoring and bonuses follow the replayed solve order. Each solve of a
+// dynamic question revalues the earlier ones at that moment, like it did live.
+// Callers must hold stateMu.
+func replayScores(users map[string]*UserState, questions map[int]Question) map[string]*userScore {
+	var events []replayEvent
+	results := make(map[string]*userScore, len(users))
+
+	for username, us := range users {
+		result := &userScore{Outcomes: map[int][]attemptOutcome{}}
+		results[username] = result
+		for questionID, qs := range us.PerQuestion {
+			outcomes := make([]attemptOutcome, len(qs.AttemptHistory))
+			result.Outcomes[questionID] = outcomes
+
+			// keep the per-question order even if the wall clock went backwards
+			var last time.Time
+			for i, attempt := range qs.AttemptHistory {
+				outcomes[i] = attemptOutcome{Correct: attempt.Correct, ScoreDelta: attempt.Score}
+				at := attempt.At
+				if at.Before(last) {
+					at = last
+				}
+				last = at
+				events = append(events, replayEvent{username: username, questionID: questionID, index: i, at: at})
+			}
+			for i, reveal := range qs.HintReveals {
+				events = append(events, replayEvent{username: username, questionID: questionID, index: i, at: reveal.At, hint: true, hintCost: reveal.Cost})
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if !a.at.Equal(b.at) {
+			return a.at.Before(b.at)
+		}
+		if a.username != b.username {
+			return a.username < b.username
+		}
+		if a.questionID != b.questionID {
+			return a.questionID < b.questionID
+		}
+		if a.hint != b.hint {
+			return a.hint // a hint revealed in the same instant came first
+		}
+		return a.index < b.index
+	})
+
+	solves := map[int]int{}
+	solvers := map[int][]replayEvent{} // of dynamic questions, in solve order
+	for _, e := range events {
+		if e.hint {
+			result := results[e.username]
+			result.TotalScore = applyScoreDelta(result.TotalScore, -e.hintCost)
+			continue
+		}
+		q, ok := questions[e.questionID]
+		if !ok {
+			continue
+		}
+		result := results[e.username]
+		history := users[e.username].PerQuestion[e.questionID].AttemptHistory
+		outcomes := result.Outcomes[e.questionID]
+
+		prior := make(AttemptRecords, e.index)
+		copy(prior, history[:e.index])
+		for i := range prior {
+			prior[i].Correct = outcomes[i].Correct
+			prior[i].Score = outcomes[i].ScoreDelta
+		}
+
+		attempt := history[e.index]
+		outcome := evaluateAttempt(q, e.username, attempt.Answer, prior, solveContext{At: attempt.At, Solves: solves[q.ID]})
+		outcomes[e.index] = outcome
+		result.TotalScore = applyScoreDelta(result.TotalScore, outcome.ScoreDelta)
+		if outcome.Correct && !outcome.AlreadySolved {
+			if !usersByUsername[e.username].IsAdmin() {
+				solves[q.ID]++
+				if q.isDynamic() {
+					for position, solver := range solvers[q.ID] {
+						earlier := results[solver.username]
+						solve := &earlier.Outcomes[q.ID][solver.index]
+						score := q.dynamicScore(solves[q.ID], position)
+						earlier.TotalScore = applyScoreDelta(earlier.TotalScore, score-solve.ScoreDelta)
+						solve.ScoreDelta = score
+					}
+					solvers[q.ID] = append(solvers[q.ID], e)
+				}
+			}
+			if q.ID > result.LastSolvedQuestion {
+				result.LastSolvedQuestion = q.ID
+			}
+		}
+	}
+
+	return results
+}
+
+type attemptChange struct {
+	QuestionID int       `json:"question_id"`
+	Answer     string    `json:"answer"`
+	At         time.Time `json:"at"`
+	OldCorrect bool      `json:"old_correct"`
+	NewCorrect bool      `json:"new_correct"`
+	OldScore   int       `json:"old_score"`
+	NewScore   int       `json:"new_score"`
+}
+
+type rescoreDiff struct {
+	Username              string          `json:"username"`
+	OldTotalScore         int             `json:"old_total_score"`
+	NewTotalScore         int             `json:"new_total_score"`
+	Delta                 int             `json:"delta"`
+	OldLastSolvedQuestion int             `json:"old_last_solved_question"`
+	NewLastSolvedQuestion int             `json:"new_last_solved_question"`
+	ChangedAttempts       []attemptChange `json:"changed_attempts,omitempty"`
+}
+
+type rescoreResponse struct {
+	Applied bool          `json:"applied"`
+	Changed int           `json:"changed"`
+	Users   []rescoreDiff `json:"users"`
+}
+
+// diffRescore compares the current state with a replay result, only users
+// whose score, progress or attempt outcomes changed are returned.
+// Callers must hold stateMu.
+func diffRescore(users map[string]*UserState, results map[string]*userScore) []rescoreDiff {
+	diffs := []rescoreDiff{}
+	for username, us := range users {
+		result := results[username]
+		diff := rescoreDiff{
+			Username:              username,
+			OldTotalScore:         us.TotalScore,
+			NewTotalScore:         result.TotalScore,
+			Delta:                 result.TotalScore - us.TotalScore,
+			OldLastSolvedQuestion: us.LastSolvedQuestion,
+			NewLastSolvedQuestion: result.LastSolvedQuestion,
+		}
+		for questionID, qs := range us.PerQuestion {
+			outcomes := result.Outcomes[questionID]
+			for i, attempt := range qs.AttemptHistory {
+				if attempt.Correct != outcomes[i].Correct || attempt.Score != outcomes[i].ScoreDelta {
+					diff.ChangedAttempts = append(diff.ChangedAttempts, attemptChange{
+						QuestionID: questionID,
+						Answer:     attempt.Answer,
+						At:         attempt.At,
+						OldCorrect: attempt.Correct,
+						NewCorrect: outcomes[i].Correct,
+						OldScore:   attempt.Score,
+						NewScore:   outcomes[i].ScoreDelta,
+					})
+				}
+			}
+		}
+		if diff.Delta == 0 && diff.OldLastSolvedQuestion == diff.NewLastSolvedQuestion && len(diff.ChangedAttempts) == 0 {
+			continue
+		}
+		sort.Slice(diff.ChangedAttempts, func(i, j int) bool {
+			return diff.ChangedAttempts[i].At.Before(diff.ChangedAttempts[j].At)
+		})
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Username < diffs[j].Username })
+	return diffs
+}
+
+// previewRescore returns what rescoreAll would change without touching state.
+func previewRescore() []rescoreDiff {
+	questions := snapshotQuestions()
+
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	return diffRescore(state.Users, replayScores(state.Users, questions))
+}
+
+// rescoreAll replays every user's history against the current questions and
+// replaces their scores, progress and attempt outcomes with the result.
+func rescoreAll() []rescoreDiff {
+	questions := snapshotQuestions()
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	results := replayScores(state.Users, questions)
+	diffs := diffRescore(state.Users, results)
+	for username, us := range state.Users {
+		result := results[username]
+		us.TotalScore = result.TotalScore
+		us.LastSolvedQuestion = result.LastSolvedQuestion
+		for questionID, qs := range us.PerQuestion {
+			outcomes := result.Outcomes[questionID]
+			for i := range qs.AttemptHistory {
+				qs.AttemptHistory[i].Correct = outcomes[i].Correct
+				qs.AttemptHistory[i].Score = outcomes[i].ScoreDelta
+			}
+		}
+	}
+	scoreboardChanged()
+	return diffs
+}
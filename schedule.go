@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------- Competition schedule --------
+
+const (
+	phaseNotStarted = "not_started"
+	phaseRunning    = "running"
+	phaseFrozen     = "frozen"
+	phaseEnded      = "ended"
+)
+
+// Schedule is when the competition runs. A zero StartAt means it is open
+// from server start, a zero EndAt means it never ends and a zero FreezeAt
+// means the scoreboard is never frozen.
+type Schedule struct {
+	StartAt  time.Time `yaml:"start_at" json:"start_at"`
+	EndAt    time.Time `yaml:"end_at" json:"end_at"`
+	FreezeAt time.Time `yaml:"freeze_at" json:"freeze_at"`
+}
+
+func (s Schedule) Phase(now time.Time) string {
+	switch {
+	case !s.StartAt.IsZero() && now.Before(s.StartAt):
+		return phaseNotStarted
+	case !s.EndAt.IsZero() && !now.Before(s.EndAt):
+		return phaseEnded
+	case !s.FreezeAt.IsZero() && !now.Before(s.FreezeAt):
+		return phaseFrozen
+	default:
+		return phaseRunning
+	}
+}
+
+// AcceptsSubmissions reports whether contestants may submit and prompt at now.
+func (s Schedule) AcceptsSubmissions(now time.Time) bool {
+	phase := s.Phase(now)
+	return phase == phaseRunning || phase == phaseFrozen
+}
+
+func (s Schedule) Validate() error {
+	var errs []error
+	if !s.StartAt.IsZero() && !s.EndAt.IsZero() && !s.EndAt.After(s.StartAt) {
+		errs = append(errs, errors.New("schedule.end_at must be after start_at"))
+	}
+	if !s.FreezeAt.IsZero() {
+		if !s.StartAt.IsZero() && s.FreezeAt.Before(s.StartAt) {
+			errs = append(errs, errors.New("schedule.freeze_at must not be before start_at"))
+		}
+		if !s.EndAt.IsZero() && !s.FreezeAt.Before(s.EndAt) {
+			errs = append(errs, errors.New("schedule.freeze_at must be before end_at"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Middleware: reject contestant requests outside the competition window,
+// organisers can always pass to test questions. Must run after JWTAuthMiddleware.
+func RequireCompetitionRunning(cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if requestRole(c) == roleAdmin {
+			c.Next()
+			return
+		}
+		now := time.Now()
+		if cfg.Schedule.AcceptsSubmissions(now) {
+			c.Next()
+			return
+		}
+		description := "competition has ended"
+		if cfg.Schedule.Phase(now) == phaseNotStarted {
+			description = "competition has not started yet"
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, baseResponse{OK: false, Description: description})
+	}
+}
+
+type competitionStatusResponse struct {
+	ServerTime time.Time  `json:"server_time"`
+	Phase      string     `json:"phase"`
+	StartAt    *time.Time `json:"start_at,omitempty"`
+	EndAt      *time.Time `json:"end_at,omitempty"`
+	FreezeAt   *time.Time `json:"freeze_at,omitempty"`
+	// seconds until the next phase change, omitted when nothing is scheduled
+	SecondsToNextPhase *int64 `json:"seconds_to_next_phase,omitempty"`
+}
+
+// competitionStatusHandler lets the frontend sync its countdown with the server clock.
+func competitionStatusHandler(cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		s := cfg.Schedule
+		resp := competitionStatusResponse{
+			ServerTime: now,
+			Phase:      s.Phase(now),
+			StartAt:    optionalTime(s.StartAt),
+			EndAt:      optionalTime(s.EndAt),
+			FreezeAt:   optionalTime(s.FreezeAt),
+		}
+
+		var next time.Time
+		switch resp.Phase {
+		case phaseNotStarted:
+			next = s.StartAt
+		case phaseRunning:
+			next = s.FreezeAt
+			if next.IsZero() {
+				next = s.EndAt
+			}
+		case phaseFrozen:
+			next = s.EndAt
+		}
+		if !next.IsZero() {
+			secs := int64(next.Sub(now).Seconds())
+			resp.SecondsToNextPhase = &secs
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
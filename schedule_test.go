@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSchedulePhase(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	freeze := start.Add(2 * time.Hour)
+	end := start.Add(3 * time.Hour)
+	full := Schedule{StartAt: start, FreezeAt: freeze, EndAt: end}
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		now      time.Time
+		want     string
+	}{
+		{"before start", full, start.Add(-time.Nanosecond), phaseNotStarted},
+		{"at start", full, start, phaseRunning},
+		{"before freeze", full, freeze.Add(-time.Nanosecond), phaseRunning},
+		{"at freeze", full, freeze, phaseFrozen},
+		{"before end", full, end.Add(-time.Nanosecond), phaseFrozen},
+		{"at end", full, end, phaseEnded},
+		{"no schedule", Schedule{}, start, phaseRunning},
+		{"no start", Schedule{EndAt: end}, start.Add(-24 * time.Hour), phaseRunning},
+		{"no end", Schedule{StartAt: start}, end.Add(24 * time.Hour), phaseRunning},
+		{"no freeze", Schedule{StartAt: start, EndAt: end}, freeze, phaseRunning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Phase(tt.now); got != tt.want {
+				t.Errorf("Phase = %s, want %s", got, tt.want)
+			}
+			want := tt.want == phaseRunning || tt.want == phaseFrozen
+			if got := tt.schedule.AcceptsSubmissions(tt.now); got != want {
+				t.Errorf("AcceptsSubmissions = %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestRequireCompetitionRunning(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		role     string
+		wantCode int
+		wantBody string
+	}{
+		{"running", Schedule{StartAt: now.Add(-time.Hour)}, roleContestant, http.StatusOK, ""},
+		{"frozen", Schedule{FreezeAt: now.Add(-time.Hour)}, roleContestant, http.StatusOK, ""},
+		{"not started", Schedule{StartAt: now.Add(time.Hour)}, roleContestant, http.StatusForbidden, "not started yet"},
+		{"ended", Schedule{EndAt: now.Add(-time.Hour)}, roleContestant, http.StatusForbidden, "has ended"},
+		{"organiser before start", Schedule{StartAt: now.Add(time.Hour)}, roleAdmin, http.StatusOK, ""},
+		{"organiser after end", Schedule{EndAt: now.Add(-time.Hour)}, roleAdmin, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/submit_answer", func(c *gin.Context) {
+				c.Set(roleKey, tt.role)
+			}, RequireCompetitionRunning(&Config{Schedule: tt.schedule}), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/submit_answer", nil))
+
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("response = %d %s, want %d containing %q", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------- Scoreboard --------
+
+// scoreboardEntry summarises one user's state for the scoreboard. With a
+// non-zero asOf only what happened until then is counted, the total is
+// rebuilt from the points each attempt and hint recorded, if they did, and
+// solves of dynamic questions count what they were worth at asOf
+// (dynamicScores, see dynamicScoresAsOf). Caller holds stateMu.
+func scoreboardEntry(username string, us *UserState, asOf time.Time, dynamicScores map[int]map[string]int) UserAllInfo {
+	info := UserAllInfo{
+		Username:        username,
+		TotalScore:      us.TotalScore,
+		SolvedQuestions: []SolvedQuestion{},
+	}
+	counts := func(at time.Time) bool { return asOf.IsZero() || !at.After(asOf) }
+
+	type scoreChange struct {
+		at    time.Time
+		delta int
+	}
+	var changes []scoreChange
+	scored := false
+	for questionID, qs := range us.PerQuestion {
+		for _, reveal := range qs.HintReveals {
+			if counts(reveal.At) {
+				info.HintCost += reveal.Cost
+				changes = append(changes, scoreChange{reveal.At, -reveal.Cost})
+			}
+		}
+		solved := false
+		for _, attempt := range qs.AttemptHistory {
+			scored = scored || attempt.Score != 0
+			if !counts(attempt.At) {
+				continue
+			}
+			score := attempt.Score
+			if points, ok := dynamicScores[questionID][username]; ok && attempt.Correct && !solved {
+				score = points
+			}
+			changes = append(changes, scoreChange{attempt.At, score})
+			if !attempt.Correct {
+				info.WrongAttempts++
+			} else if !solved {
+				// the first correct attempt is the solve, it carries the points awarded
+				solved = true
+				info.SolvedQuestions = append(info.SolvedQuestions, SolvedQuestion{
+					QuestionID: questionID,
+					SolvedAt:   attempt.At,
+					Score:      score,
+				})
+			}
+		}
+	}
+	// attempts stored before they carried their points all have 0 until the
+	// next rescore, the live total is closer than a rebuilt one
+	if !asOf.IsZero() && (scored || us.TotalScore == 0) {
+		sort.SliceStable(changes, func(i, j int) bool { return changes[i].at.Before(changes[j].at) })
+		info.TotalScore = 0
+		for _, c := range changes {
+			info.TotalScore = applyScoreDelta(info.TotalScore, c.delta)
+		}
+	}
+	sort.Slice(info.SolvedQuestions, func(i, j int) bool {
+		return info.SolvedQuestions[i].SolvedAt.Before(info.SolvedQuestions[j].SolvedAt)
+	})
+	// points are only gained by solving
+	if n := len(info.SolvedQuestions); n > 0 {
+		last := info.SolvedQuestions[n-1].SolvedAt
+		info.LastGainAt = &last
+	}
+	return info
+}
+
+// buildScoreboard ranks every contestant in state, organisers are left out.
+// With a non-zero frozenAt teams that were not revealed yet are shown as
+// they were at that time. Caller holds stateMu.
+func buildScoreboard(frozenAt time.Time) []UserAllInfo {
+	var dynamicScores map[int]map[string]int
+	if !frozenAt.IsZero() {
+		dynamicScores = dynamicScoresAsOf(state.Users, snapshotQuestions(), frozenAt)
+	}
+	users := make([]UserAllInfo, 0, len(state.Users))
+	for username, us := range state.Users {
+		if usersByUsername[username].IsAdmin() {
+			continue
+		}
+		if state.Revealed[username] {
+			users = append(users, scoreboardEntry(username, us, time.Time{}, nil))
+		} else {
+			users = append(users, scoreboardEntry(username, us, frozenAt, dynamicScores))
+		}
+	}
+	rankUsers(users)
+	return users
+}
+
+// scoreboardFrozenAt returns the freeze time while contestants must not see
+// live results, the zero time otherwise. Caller holds stateMu.
+func scoreboardFrozenAt(cfg *Config, now time.Time) time.Time {
+	freezeAt := cfg.Schedule.FreezeAt
+	if freezeAt.IsZero() || now.Before(freezeAt) || state.Unfrozen {
+		return time.Time{}
+	}
+	return freezeAt
+}
+
+// rankUsers sorts by score, then earlier last gain, then fewer wrong
+// attempts. Users tied on all three share a rank and the next rank is
+// skipped (1, 2, 2, 4); their order among each other is by name.
+func rankUsers(users []UserAllInfo) {
+	sort.Slice(users, func(i, j int) bool {
+		if c := compareRank(users[i], users[j]); c != 0 {
+			return c < 0
+		}
+		return users[i].Username < users[j].Username
+	})
+	for i := range users {
+		if i > 0 && compareRank(users[i-1], users[i]) == 0 {
+			users[i].Rank = users[i-1].Rank
+		} else {
+			users[i].Rank = i + 1
+		}
+	}
+}
+
+// compareRank is negative if a ranks above b. A user who never gained
+// points ranks below one who did at the same score.
+func compareRank(a, b UserAllInfo) int {
+	if a.TotalScore != b.TotalScore {
+		return b.TotalScore - a.TotalScore
+	}
+	switch {
+	case a.LastGainAt == nil && b.LastGainAt != nil:
+		return 1
+	case a.LastGainAt != nil && b.LastGainAt == nil:
+		return -1
+	case a.LastGainAt != nil && !a.LastGainAt.Equal(*b.LastGainAt):
+		return a.LastGainAt.Compare(*b.LastGainAt)
+	}
+	return a.WrongAttempts - b.WrongAttempts
+}
+
+// pageParams reads ?offset= and ?limit= with limit 0 meaning all.
+func pageParams(offsetParam, limitParam string) (offset, limit int, ok bool) {
+	var err error
+	if offsetParam != "" {
+		if offset, err = strconv.Atoi(offsetParam); err != nil || offset < 0 {
+			return 0, 0, false
+		}
+	}
+	if limitParam != "" {
+		if limit, err = strconv.Atoi(limitParam); err != nil || limit < 0 {
+			return 0, 0, false
+		}
+	}
+	return offset, limit, true
+}
+
+func paginate(users []UserAllInfo, offset, limit int) []UserAllInfo {
+	if offset >= len(users) {
+		return []UserAllInfo{}
+	}
+	users = users[offset:]
+	if limit > 0 && limit < len(users) {
+		users = users[:limit]
+	}
+	return users
+}
+
+type revealRequest struct {
+	// team to reveal, empty reveals the lowest ranked team still hidden
+	Username string `json:"username"`
+}
+
+type revealResponse struct {
+	Revealed *UserAllInfo `json:"revealed,omitempty"`
+	// teams still hidden
+	Remaining int `json:"remaining"`
+}
+
+// adminRevealHandler shows one team's live results on the frozen scoreboard,
+// by default the lowest ranked one so the reveal climbs towards first place.
+func adminRevealHandler(cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req revealRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "invalid request body"})
+				return
+			}
+		}
+
+		stateMu.Lock()
+		defer stateMu.Unlock()
+
+		now := time.Now()
+		frozenAt := scoreboardFrozenAt(cfg, now)
+		if frozenAt.IsZero() {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "scoreboard is not frozen"})
+			return
+		}
+		// live results would tell teams still submitting what the others did
+		if cfg.Schedule.Phase(now) != phaseEnded {
+			c.JSON(http.StatusBadRequest, baseResponse{OK: false, Description: "competition has not ended yet"})
+			return
+		}
+
+		board := buildScoreboard(frozenAt)
+		username := req.Username
+		if username == "" {
+			for i := len(board) - 1; i >= 0; i-- {
+				if !state.Revealed[board[i].Username] {
+					username = board[i].Username
+					break
+				}
+			}
+			if username == "" {
+				c.JSON(http.StatusOK, revealResponse{Remaining: 0})
+				return
+			}
+		}
+		if _, ok := state.Users[username]; !ok || usersByUsername[username].IsAdmin() {
+			c.JSON(http.StatusNotFound, baseResponse{OK: false, Description: "unknown team"})
+			return
+		}
+
+		if !state.Revealed[username] {
+			if err := recordEvent(stateEvent{Type: eventReveal, Username: username}); err != nil {
+				c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to record reveal"})
+				return
+			}
+			log.Printf("scoreboard: revealed %q", username)
+		}
+
+		resp := revealResponse{}
+		for _, entry := range buildScoreboard(frozenAt) {
+			if entry.Username == username {
+				resp.Revealed = &entry
+			} else if !state.Revealed[entry.Username] {
+				resp.Remaining++
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// adminUnfreezeHandler shows everyone's live results for good.
+func adminUnfreezeHandler(c *gin.Context) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if !state.Unfrozen {
+		if err := recordEvent(stateEvent{Type: eventUnfreeze}); err != nil {
+			c.JSON(http.StatusInternalServerError, baseResponse{OK: false, Description: "failed to record unfreeze"})
+			return
+		}
+		log.Printf("scoreboard: unfrozen")
+	}
+	c.JSON(http.StatusOK, baseResponse{OK: true, Description: "scoreboard unfrozen"})
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------- Live scoreboard --------
+
+const (
+	scoreboardHistory      = 100              // deltas kept per view for reconnecting clients
+	scoreboardBuffer       = 32               // deltas queued per client before it is dropped
+	scoreboardPingInterval = 25 * time.Second // keeps proxies from closing idle streams
+)
+
+// scoreboardHub caches the ranked scoreboard and pushes what changed to
+// streaming clients. State changes only mark it stale, a background worker
+// rebuilds it once for everyone instead of once per request. There are two
+// views: the live one organisers see and the one contestants see, which
+// stays frozen while the schedule says so.
+type scoreboardHub struct {
+	cfg *Config
+	// delta ids are "<epoch>-<seq>", a restarted server never resumes an old stream
+	epoch string
+
+	stale  atomic.Bool
+	notify chan struct{}
+
+	mu            sync.Mutex
+	built         bool
+	freezeStarted bool
+	live          scoreboardView
+	public        scoreboardView
+	subscribers   map[*scoreboardSubscriber]struct{}
+	closed        bool
+
+	done chan struct{}
+}
+
+type scoreboardView struct {
+	seq     uint64
+	users   []UserAllInfo
+	frozen  bool
+	history []sseMessage // oldest first, consecutive seqs ending at seq
+}
+
+type scoreboardSubscriber struct {
+	admin    bool
+	messages chan sseMessage
+}
+
+// scoreboardDelta is what changed between two scoreboard versions. Users
+// holds the changed entries with their new rank.
+type scoreboardDelta struct {
+	Frozen  bool              `json:"frozen"`
+	Total   int               `json:"total"`
+	Solves  []scoreboardSolve `json:"solves"`
+	Users   []UserAllInfo     `json:"users"`
+	Removed []string          `json:"removed,omitempty"`
+}
+
+type scoreboardSolve struct {
+	Username   string    `json:"username"`
+	QuestionID int       `json:"question_id"`
+	Score      int       `json:"score"`
+	SolvedAt   time.Time `json:"solved_at"`
+}
+
+var scoreboard *scoreboardHub
+
+func newScoreboardHub(cfg *Config) *scoreboardHub {
+	h := &scoreboardHub{
+		cfg:         cfg,
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		notify:      make(chan struct{}, 1),
+		subscribers: map[*scoreboardSubscriber]struct{}{},
+		done:        make(chan struct{}),
+	}
+	h.stale.Store(true)
+	return h
+}
+
+func (h *scoreboardHub) Start() {
+	go h.loop()
+}
+
+// loop rebuilds after changes, and every second so the freeze starts on time.
+func (h *scoreboardHub) loop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.notify:
+		case <-ticker.C:
+		case <-h.done:
+			return
+		}
+		h.mu.Lock()
+		h.refresh(time.Now())
+		h.mu.Unlock()
+	}
+}
+
+// scoreboardChanged marks the cached scoreboard stale. It does not lock
+// anything, so it is safe while holding stateMu.
+func scoreboardChanged() {
+	if scoreboard == nil {
+		return
+	}
+	scoreboard.stale.Store(true)
+	select {
+	case scoreboard.notify <- struct{}{}:
+	default: // a rebuild is already pending
+	}
+}
+
+// Board returns the cached scoreboard for a viewer with role. The slice is
+// shared, callers must not modify it.
+func (h *scoreboardHub) Board(role string) (users []UserAllInfo, frozen bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.refresh(time.Now())
+	view := h.view(role == roleAdmin)
+	return view.users, view.frozen
+}
+
+func (h *scoreboardHub) view(admin bool) *scoreboardView {
+	if admin {
+		return &h.live
+	}
+	return &h.public
+}
+
+// refresh rebuilds both views if state changed or the freeze began, and
+// sends the differences to subscribers. Caller holds h.mu, which is always
+// taken before stateMu.
+func (h *scoreboardHub) refresh(now time.Time) {
+	freezeAt := h.cfg.Schedule.FreezeAt
+	freezeStarted := !freezeAt.IsZero() && !now.Before(freezeAt)
+	if h.built && !h.stale.Swap(false) && freezeStarted == h.freezeStarted {
+		return
+	}
+	h.stale.Store(false)
+
+	stateMu.RLock()
+	live := buildScoreboard(time.Time{})
+	public := live
+	frozenAt := scoreboardFrozenAt(h.cfg, now)
+	if !frozenAt.IsZero() {
+		public = buildScoreboard(frozenAt)
+	}
+	stateMu.RUnlock()
+
+	h.freezeStarted = freezeStarted
+	if !h.built {
+		h.built = true
+		h.live.users, h.public.users = live, public
+		h.public.frozen = !frozenAt.IsZero()
+		return
+	}
+	if msg, ok := h.live.update(h.epoch, live, false); ok {
+		h.broadcast(true, msg)
+	}
+	if msg, ok := h.public.update(h.epoch, public, !frozenAt.IsZero()); ok {
+		h.broadcast(false, msg)
+	}
+}
+
+// update replaces the view's users and returns the delta, false if nothing changed.
+func (v *scoreboardView) update(epoch string, users []UserAllInfo, frozen bool) (sseMessage, bool) {
+	delta := scoreboardDelta{Frozen: frozen, Total: len(users), Solves: []scoreboardSolve{}, Users: []UserAllInfo{}}
+	old := make(map[string]UserAllInfo, len(v.users))
+	for _, entry := range v.users {
+		old[entry.Username] = entry
+	}
+	for _, entry := range users {
+		before, existed := old[entry.Username]
+		delete(old, entry.Username)
+		if existed && reflect.DeepEqual(before, entry) {
+			continue
+		}
+		delta.Users = append(delta.Users, entry)
+		solvedBefore := map[int]bool{}
+		for _, s := range before.SolvedQuestions {
+			solvedBefore[s.QuestionID] = true
+		}
+		for _, s := range entry.SolvedQuestions {
+			if !solvedBefore[s.QuestionID] {
+				delta.Solves = append(delta.Solves, scoreboardSolve{
+					Username:   entry.Username,
+					QuestionID: s.QuestionID,
+					Score:      s.Score,
+					SolvedAt:   s.SolvedAt,
+				})
+			}
+		}
+	}
+	for username := range old {
+		delta.Removed = append(delta.Removed, username)
+	}
+	if len(delta.Users) == 0 && len(delta.Removed) == 0 && frozen == v.frozen {
+		return sseMessage{}, false
+	}
+
+	v.users, v.frozen = users, frozen
+	v.seq++
+	msg := newSSEMessage(epoch+"-"+strconv.FormatUint(v.seq, 10), "delta", delta)
+	v.history = append(v.history, msg)
+	if len(v.history) > scoreboardHistory {
+		v.history = v.history[len(v.history)-scoreboardHistory:]
+	}
+	return msg, true
+}
+
+// since returns the deltas after lastEventID, or a snapshot when the client
+// is new or too far behind.
+func (v *scoreboardView) since(epoch, lastEventID string) []sseMessage {
+	if seqText, ok := strings.CutPrefix(lastEventID, epoch+"-"); ok {
+		if seq, err := strconv.ParseUint(seqText, 10, 64); err == nil && seq <= v.seq {
+			missed := int(v.seq - seq)
+			if missed <= len(v.history) {
+				return append([]sseMessage(nil), v.history[len(v.history)-missed:]...)
+			}
+		}
+	}
+	snapshot := GetAllUsersResponse{Users: v.users, Total: len(v.users), Frozen: v.frozen}
+	return []sseMessage{newSSEMessage(epoch+"-"+strconv.FormatUint(v.seq, 10), "snapshot", snapshot)}
+}
+
+// broadcast queues msg for every subscriber of the view. Clients that fall
+// behind are dropped, they reconnect with Last-Event-ID. Caller holds h.mu.
+func (h *scoreboardHub) broadcast(admin bool, msg sseMessage) {
+	for sub := range h.subscribers {
+		if sub.admin != admin {
+			continue
+		}
+		select {
+		case sub.messages <- msg:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.messages)
+		}
+	}
+}
+
+// Subscribe registers a client and returns what it must be sent first. It
+// returns nil once the hub is closed.
+func (h *scoreboardHub) Subscribe(role, lastEventID string) (*scoreboardSubscriber, []sseMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, nil
+	}
+	h.refresh(time.Now())
+	sub := &scoreboardSubscriber{admin: role == roleAdmin, messages: make(chan sseMessage, scoreboardBuffer)}
+	h.subscribers[sub] = struct{}{}
+	return sub, h.view(sub.admin).since(h.epoch, lastEventID)
+}
+
+func (h *scoreboardHub) Unsubscribe(sub *scoreboardSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.messages)
+	}
+}
+
+// Close ends every stream so a graceful shutdown does not wait for them.
+func (h *scoreboardHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.messages)
+	}
+}
+
+// sseMessage is one Server-Sent Event with its data already encoded.
+type sseMessage struct {
+	ID    string
+	Event string
+	Data  []byte
+}
+
+func newSSEMessage(id, event string, data any) sseMessage {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		// only plain structs are sent
+		log.Printf("sse: failed to encode %s: %v", event, err)
+	}
+	return sseMessage{ID: id, Event: event, Data: encoded}
+}
+
+func writeSSE(w io.Writer, msg sseMessage) error {
+	if msg.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", msg.ID); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Event, msg.Data)
+	return err
+}
+
+// startSSE sends the headers of an event stream.
+func startSSE(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginx would hold events back otherwise
+	c.Status(http.StatusOK)
+}
+
+// scoreboardStreamHandler streams the scoreboard: a snapshot first, then a
+// delta whenever it changes. A client reconnecting with Last-Event-ID gets
+// the deltas it missed instead of a new snapshot.
+func scoreboardStreamHandler(c *gin.Context) {
+	sub, backlog := scoreboard.Subscribe(requestRole(c), c.GetHeader("Last-Event-ID"))
+	if sub == nil {
+		c.JSON(http.StatusServiceUnavailable, baseResponse{OK: false, Description: "server is shutting down"})
+		return
+	}
+	defer scoreboard.Unsubscribe(sub)
+
+	startSSE(c)
+	for _, msg := range backlog {
+		if writeSSE(c.Writer, msg) != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	ping := time.NewTicker(scoreboardPingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case msg, ok := <-sub.messages:
+			if !ok {
+				return
+			}
+			err = writeSSE(c.Writer, msg)
+		case <-ping.C:
+			_, err = io.WriteString(c.Writer, ": ping\n\n")
+		case <-c.Request.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func streamEntry(username string, rank int, solved ...int) UserAllInfo {
+	info := UserAllInfo{Username: username, Rank: rank, SolvedQuestions: []SolvedQuestion{}}
+	for _, questionID := range solved {
+		at := time.Date(2025, 1, 1, 10, questionID, 0, 0, time.UTC)
+		info.SolvedQuestions = append(info.SolvedQuestions, SolvedQuestion{QuestionID: questionID, SolvedAt: at, Score: 10})
+		info.TotalScore += 10
+	}
+	return info
+}
+
+func decodeDelta(t *testing.T, msg sseMessage) scoreboardDelta {
+	t.Helper()
+	if msg.Event != "delta" {
+		t.Fatalf("event = %q, want delta", msg.Event)
+	}
+	var delta scoreboardDelta
+	if err := json.Unmarshal(msg.Data, &delta); err != nil {
+		t.Fatalf("decode delta: %v", err)
+	}
+	return delta
+}
+
+func TestScoreboardViewUpdate(t *testing.T) {
+	base := []UserAllInfo{streamEntry("a", 1, 1), streamEntry("b", 2), streamEntry("c", 2)}
+
+	tests := []struct {
+		name        string
+		users       []UserAllInfo
+		frozen      bool
+		wantChange  bool
+		wantUsers   []string
+		wantSolves  []string // username/question
+		wantRemoved []string
+	}{
+		{"nothing changed", base, false, false, nil, nil, nil},
+		{
+			"new solve moves a team up",
+			[]UserAllInfo{streamEntry("a", 1, 1), streamEntry("b", 1, 2), streamEntry("c", 3)},
+			false, true, []string{"b", "c"}, []string{"b/2"}, nil,
+		},
+		{
+			"team removed",
+			[]UserAllInfo{streamEntry("a", 1, 1), streamEntry("b", 2)},
+			false, true, nil, nil, []string{"c"},
+		},
+		{
+			"team added",
+			append(append([]UserAllInfo(nil), base...), streamEntry("d", 2)),
+			false, true, []string{"d"}, nil, nil,
+		},
+		{"only the freeze started", base, true, true, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := scoreboardView{users: base}
+			msg, changed := v.update("e", tt.users, tt.frozen)
+			if changed != tt.wantChange {
+				t.Fatalf("changed = %t, want %t", changed, tt.wantChange)
+			}
+			if !changed {
+				if v.seq != 0 || len(v.history) != 0 {
+					t.Errorf("unchanged update bumped seq to %d with %d history", v.seq, len(v.history))
+				}
+				return
+			}
+			if msg.ID != "e-1" || v.seq != 1 || len(v.history) != 1 {
+				t.Errorf("id %q seq %d history %d, want e-1, 1, 1", msg.ID, v.seq, len(v.history))
+			}
+
+			delta := decodeDelta(t, msg)
+			var users, solves []string
+			for _, u := range delta.Users {
+				users = append(users, u.Username)
+			}
+			for _, s := range delta.Solves {
+				solves = append(solves, fmt.Sprintf("%s/%d", s.Username, s.QuestionID))
+			}
+			if fmt.Sprint(users) != fmt.Sprint(tt.wantUsers) {
+				t.Errorf("users = %v, want %v", users, tt.wantUsers)
+			}
+			if fmt.Sprint(solves) != fmt.Sprint(tt.wantSolves) {
+				t.Errorf("solves = %v, want %v", solves, tt.wantSolves)
+			}
+			if fmt.Sprint(delta.Removed) != fmt.Sprint(tt.wantRemoved) {
+				t.Errorf("removed = %v, want %v", delta.Removed, tt.wantRemoved)
+			}
+			if delta.Frozen != tt.frozen || delta.Total != len(tt.users) {
+				t.Errorf("frozen %t total %d, want %t, %d", delta.Frozen, delta.Total, tt.frozen, len(tt.users))
+			}
+		})
+	}
+}
+
+func TestScoreboardViewHistoryLimit(t *testing.T) {
+	var v scoreboardView
+	for i := 1; i <= scoreboardHistory+5; i++ {
+		if _, changed := v.update("e", []UserAllInfo{{Username: "a", TotalScore: i}}, false); !changed {
+			t.Fatalf("update %d reported no change", i)
+		}
+	}
+	if len(v.history) != scoreboardHistory {
+		t.Fatalf("history holds %d deltas, want %d", len(v.history), scoreboardHistory)
+	}
+	if first := v.history[0].ID; first != "e-6" {
+		t.Errorf("oldest kept delta = %s, want e-6", first)
+	}
+}
+
+func TestScoreboardViewSince(t *testing.T) {
+	var v scoreboardView
+	for i := 1; i <= scoreboardHistory+10; i++ {
+		v.update("e", []UserAllInfo{{Username: "a", TotalScore: i}}, false)
+	}
+	// seq is now 110, history holds 11 to 110
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		wantEvent   string // of the first message
+		wantIDs     []string
+	}{
+		{"new client", "", "snapshot", []string{"e-110"}},
+		{"current", "e-110", "", nil},
+		{"recent", "e-107", "delta", []string{"e-108", "e-109", "e-110"}},
+		{"oldest kept", "e-10", "delta", nil}, // all 100, checked by count below
+		{"too old", "e-9", "snapshot", []string{"e-110"}},
+		{"other epoch", "old-110", "snapshot", []string{"e-110"}},
+		{"ahead of the server", "e-111", "snapshot", []string{"e-110"}},
+		{"garbage", "e-x", "snapshot", []string{"e-110"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs := v.since("e", tt.lastEventID)
+			if tt.wantEvent == "" {
+				if len(msgs) != 0 {
+					t.Errorf("got %d messages, want none", len(msgs))
+				}
+				return
+			}
+			if len(msgs) == 0 || msgs[0].Event != tt.wantEvent {
+				t.Fatalf("got %v, want %s first", msgs, tt.wantEvent)
+			}
+			if tt.wantIDs == nil {
+				if len(msgs) != scoreboardHistory {
+					t.Errorf("got %d deltas, want %d", len(msgs), scoreboardHistory)
+				}
+				return
+			}
+			var ids []string
+			for _, m := range msgs {
+				ids = append(ids, m.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestScoreboardViewSinceSnapshot(t *testing.T) {
+	v := scoreboardView{users: []UserAllInfo{streamEntry("a", 1, 1)}, frozen: true}
+	msgs := v.since("e", "")
+	var snapshot GetAllUsersResponse
+	if err := json.Unmarshal(msgs[0].Data, &snapshot); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if snapshot.Total != 1 || !snapshot.Frozen || snapshot.Users[0].Username != "a" {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func rankEntry(username string, score int, lastGainMinute int, wrong int) UserAllInfo {
+	info := UserAllInfo{Username: username, TotalScore: score, WrongAttempts: wrong}
+	if lastGainMinute >= 0 {
+		at := time.Date(2025, 1, 1, 10, lastGainMinute, 0, 0, time.UTC)
+		info.LastGainAt = &at
+	}
+	return info
+}
+
+func TestCompareRank(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b UserAllInfo
+		want int // sign only
+	}{
+		{"higher score first", rankEntry("a", 20, 30, 5), rankEntry("b", 10, 0, 0), -1},
+		{"lower score last", rankEntry("a", 10, 0, 0), rankEntry("b", 20, 30, 5), 1},
+		{"earlier last gain first", rankEntry("a", 10, 5, 9), rankEntry("b", 10, 6, 0), -1},
+		{"later last gain last", rankEntry("a", 10, 6, 0), rankEntry("b", 10, 5, 9), 1},
+		{"fewer wrong answers first", rankEntry("a", 10, 5, 1), rankEntry("b", 10, 5, 2), -1},
+		{"tied", rankEntry("a", 10, 5, 1), rankEntry("b", 10, 5, 1), 0},
+		{"never gained ranks below", rankEntry("a", 0, -1, 0), rankEntry("b", 0, 5, 3), 1},
+		{"gained ranks above", rankEntry("a", 0, 5, 3), rankEntry("b", 0, -1, 0), -1},
+		{"neither gained", rankEntry("a", 0, -1, 2), rankEntry("b", 0, -1, 1), 1},
+	}
+	sign := func(n int) int {
+		switch {
+		case n < 0:
+			return -1
+		case n > 0:
+			return 1
+		}
+		return 0
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sign(compareRank(tt.a, tt.b)); got != tt.want {
+				t.Errorf("compareRank = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankUsers(t *testing.T) {
+	users := []UserAllInfo{
+		rankEntry("e", 0, -1, 0),
+		rankEntry("d", 10, 20, 1),
+		rankEntry("c", 10, 20, 1),
+		rankEntry("b", 10, 10, 4),
+		rankEntry("a", 30, 40, 0),
+		rankEntry("f", 10, 20, 2),
+	}
+	rankUsers(users)
+
+	want := []struct {
+		username string
+		rank     int
+	}{
+		{"a", 1},
+		{"b", 2},
+		{"c", 3}, // c and d tie, ordered by name
+		{"d", 3},
+		{"f", 5},
+		{"e", 6},
+	}
+	for i, w := range want {
+		if users[i].Username != w.username || users[i].Rank != w.rank {
+			t.Errorf("position %d = %s rank %d, want %s rank %d", i, users[i].Username, users[i].Rank, w.username, w.rank)
+		}
+	}
+}
+
+func TestRankUsersEmpty(t *testing.T) {
+	rankUsers(nil)
+	users := []UserAllInfo{rankEntry("a", 0, -1, 0)}
+	rankUsers(users)
+	if users[0].Rank != 1 {
+		t.Errorf("single user rank = %d, want 1", users[0].Rank)
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	tests := []struct {
+		offset, limit         string
+		wantOffset, wantLimit int
+		wantOK                bool
+	}{
+		{"", "", 0, 0, true},
+		{"20", "10", 20, 10, true},
+		{"0", "0", 0, 0, true},
+		{"-1", "", 0, 0, false},
+		{"", "-5", 0, 0, false},
+		{"x", "", 0, 0, false},
+		{"", "1.5", 0, 0, false},
+	}
+	for _, tt := range tests {
+		offset, limit, ok := pageParams(tt.offset, tt.limit)
+		if offset != tt.wantOffset || limit != tt.wantLimit || ok != tt.wantOK {
+			t.Errorf("pageParams(%q, %q) = %d, %d, %t; want %d, %d, %t",
+				tt.offset, tt.limit, offset, limit, ok, tt.wantOffset, tt.wantLimit, tt.wantOK)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	var users []UserAllInfo
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		users = append(users, UserAllInfo{Username: name})
+	}
+	names := func(page []UserAllInfo) string {
+		s := ""
+		for _, u := range page {
+			s += u.Username
+		}
+		return s
+	}
+
+	tests := []struct {
+		offset, limit int
+		want          string
+	}{
+		{0, 0, "abcde"},
+		{0, 2, "ab"},
+		{2, 2, "cd"},
+		{4, 2, "e"},
+		{3, 0, "de"},
+		{0, 10, "abcde"},
+		{5, 2, ""},
+		{9, 0, ""},
+	}
+	for _, tt := range tests {
+		page := paginate(users, tt.offset, tt.limit)
+		if got := names(page); got != tt.want {
+			t.Errorf("paginate(offset %d, limit %d) = %q, want %q", tt.offset, tt.limit, got, tt.want)
+		}
+		if page == nil {
+			t.Errorf("paginate(offset %d, limit %d) returned nil, want an empty page", tt.offset, tt.limit)
+		}
+	}
+}
+
+func TestScoreboardEntryAsOf(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2025, 1, 1, 10, minute, 0, 0, time.UTC) }
+	freeze := at(30)
+
+	tests := []struct {
+		name      string
+		us        *UserState
+		wantTotal int
+		wantSolve int
+	}{
+		{
+			"solve after the freeze is hidden",
+			&UserState{TotalScore: 150, PerQuestion: map[int]*UserQuestionState{
+				1: {AttemptHistory: AttemptRecords{{QuestionID: 1, Correct: true, Score: 100, At: at(10)}}},
+				2: {AttemptHistory: AttemptRecords{{QuestionID: 2, Correct: true, Score: 50, At: at(40)}}},
+			}},
+			100, 1,
+		},
+		{
+			"penalties and hints before the freeze count",
+			&UserState{TotalScore: 90, PerQuestion: map[int]*UserQuestionState{
+				1: {AttemptHistory: AttemptRecords{{QuestionID: 1, Correct: true, Score: 100, At: at(10)}}},
+				2: {
+					AttemptHistory: AttemptRecords{{QuestionID: 2, Score: -5, At: at(20)}},
+					HintReveals:    []HintReveal{{Cost: 5, At: at(15)}},
+				},
+			}},
+			90, 1,
+		},
+		{
+			// attempts from before scores were stored, nothing to rebuild from
+			"legacy history keeps the live total",
+			&UserState{TotalScore: 150, PerQuestion: map[int]*UserQuestionState{
+				1: {AttemptHistory: AttemptRecords{{QuestionID: 1, Correct: true, At: at(10)}}},
+				2: {AttemptHistory: AttemptRecords{{QuestionID: 2, Correct: true, At: at(40)}}},
+			}},
+			150, 1,
+		},
+		{
+			"only solve after the freeze",
+			&UserState{TotalScore: 50, PerQuestion: map[int]*UserQuestionState{
+				2: {AttemptHistory: AttemptRecords{{QuestionID: 2, Correct: true, Score: 50, At: at(40)}}},
+			}},
+			0, 0,
+		},
+		{"nothing yet", &UserState{PerQuestion: map[int]*UserQuestionState{}}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scoreboardEntry("a", tt.us, freeze, nil)
+			if got.TotalScore != tt.wantTotal || len(got.SolvedQuestions) != tt.wantSolve {
+				t.Errorf("frozen entry = %d points, %d solves; want %d, %d",
+					got.TotalScore, len(got.SolvedQuestions), tt.wantTotal, tt.wantSolve)
+			}
+			if live := scoreboardEntry("a", tt.us, time.Time{}, nil); live.TotalScore != tt.us.TotalScore {
+				t.Errorf("live total = %d, want %d", live.TotalScore, tt.us.TotalScore)
+			}
+		})
+	}
+}
+
+func TestAdminRevealBeforeEnd(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oldState := state
+	state = newTestState(0)
+	t.Cleanup(func() { state = oldState })
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		schedule Schedule
+		want     string
+	}{
+		{"not frozen", Schedule{EndAt: now.Add(-time.Hour)}, "scoreboard is not frozen"},
+		{"still running", Schedule{FreezeAt: now.Add(-time.Hour), EndAt: now.Add(time.Hour)}, "competition has not ended yet"},
+		{"no end", Schedule{FreezeAt: now.Add(-time.Hour)}, "competition has not ended yet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/admin/scoreboard/reveal", nil)
+			adminRevealHandler(&Config{Schedule: tt.schedule})(c)
+
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("reveal = %d %s, want 400 %q", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
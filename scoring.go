@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// -------- Scoring --------
+
+const (
+	scoringStatic           = "static"            // Question.Score, today's behaviour
+	scoringLinearDecay      = "linear_decay"      // lose DecayPerMinute points per minute since the start
+	scoringExponentialDecay = "exponential_decay" // halve every HalfLifeMinutes since the start
+	// CTF style: the question is worth less for everyone the more teams solve
+	// it, earlier solvers lose points when others catch up
+	scoringDynamic = "dynamic"
+)
+
+// ScoringPolicy decides how many points a solve is worth. Points are fixed
+// when the question is solved, except with dynamic scoring where every solve
+// lowers what all solvers get.
+type ScoringPolicy struct {
+	Strategy        string  `json:"strategy,omitempty"`
+	MinScore        int     `json:"min_score,omitempty"`         // floor of the decaying strategies
+	DecayPerMinute  float64 `json:"decay_per_minute,omitempty"`  // linear_decay
+	HalfLifeMinutes float64 `json:"half_life_minutes,omitempty"` // exponential_decay
+	DecaySolves     int     `json:"decay_solves,omitempty"`      // dynamic, solves until min_score is reached
+	// extra points for the first, second, ... team to solve
+	Bonuses []int `json:"bonuses,omitempty"`
+}
+
+// contestStart is schedule.start_at, the reference of the decaying strategies.
+var contestStart time.Time
+
+// solveContext is what scoring needs to know beyond the user's own attempts.
+type solveContext struct {
+	At     time.Time // when the answer was submitted
+	Solves int       // teams that solved the question before
+}
+
+// attemptOutcome is what a single submission does to a user's score.
+type attemptOutcome struct {
+	Correct        bool
+	AlreadySolved  bool
+	PenaltyApplied bool
+	// made during a lockout, only possible when replaying under a new policy
+	LockedOut  bool
+	ScoreDelta int
+}
+
+// evaluateAttempt scores one answer given the attempts made on the question
+// before it. It is shared by checkAnswer and the rescoring replay so both
+// always agree.
+func evaluateAttempt(q Question, username, answer string, prior AttemptRecords, ctx solveContext) attemptOutcome {
+	// If already solved, do not award points again
+	if prior.Solved() {
+		return attemptOutcome{Correct: true, AlreadySolved: true}
+	}
+	if ctx.At.Before(q.lockedUntil(prior)) {
+		return attemptOutcome{LockedOut: true}
+	}
+
+	if answerMatches(q, username, answer) {
+		return attemptOutcome{Correct: true, ScoreDelta: q.solveScore(ctx)}
+	}
+
+	//handle penalty
+	if penalty := q.wrongAnswerPenalty(prior); penalty > 0 {
+		return attemptOutcome{PenaltyApplied: true, ScoreDelta: -penalty}
+	}
+	return attemptOutcome{}
+}
+
+// solveScore is what solving q is worth in ctx, bonus included.
+func (q Question) solveScore(ctx solveContext) int {
+	return q.baseScore(ctx) + q.solveBonus(ctx.Solves)
+}
+
+// baseScore is solveScore without the bonus.
+func (q Question) baseScore(ctx solveContext) int {
+	p := q.Scoring
+	if p == nil {
+		return q.Score
+	}
+
+	points := q.Score
+	score := float64(q.Score)
+	minutes := max(ctx.At.Sub(contestStart).Minutes(), 0)
+	switch p.Strategy {
+	case scoringLinearDecay:
+		points = p.floor(score - p.DecayPerMinute*minutes)
+	case scoringExponentialDecay:
+		points = p.floor(score * math.Pow(0.5, minutes/p.HalfLifeMinutes))
+	case scoringDynamic:
+		// CTFd's curve: quadratic from Score down to MinScore at DecaySolves
+		solves := float64(ctx.Solves)
+		decay := float64(p.DecaySolves)
+		points = p.floor(score + (float64(p.MinScore)-score)/(decay*decay)*solves*solves)
+	}
+	return points
+}
+
+// solveBonus is the bonus of the team that solves q after solves others.
+func (q Question) solveBonus(solves int) int {
+	if q.Scoring == nil || solves >= len(q.Scoring.Bonuses) {
+		return 0
+	}
+	return q.Scoring.Bonuses[solves]
+}
+
+func (q Question) isDynamic() bool {
+	return q.Scoring != nil && q.Scoring.Strategy == scoringDynamic
+}
+
+// dynamicScore is what the position-th solver (0 for the first) of a dynamic
+// question gets once solves teams have solved it.
+func (q Question) dynamicScore(solves, position int) int {
+	return q.baseScore(solveContext{Solves: solves - 1}) + q.solveBonus(position)
+}
+
+func (p *ScoringPolicy) floor(score float64) int {
+	return max(int(math.Ceil(score)), p.MinScore)
+}
+
+func (p *ScoringPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.MinScore < 0 {
+		return errors.New("scoring.min_score must not be negative")
+	}
+	for _, bonus := range p.Bonuses {
+		if bonus < 0 {
+			return errors.New("scoring.bonuses must not be negative")
+		}
+	}
+	switch p.Strategy {
+	case "", scoringStatic:
+	case scoringLinearDecay:
+		if p.DecayPerMinute <= 0 {
+			return errors.New("linear_decay needs a positive decay_per_minute")
+		}
+	case scoringExponentialDecay:
+		if p.HalfLifeMinutes <= 0 {
+			return errors.New("exponential_decay needs a positive half_life_minutes")
+		}
+	case scoringDynamic:
+		if p.DecaySolves < 1 {
+			return errors.New("dynamic needs decay_solves of at least 1")
+		}
+	default:
+		return fmt.Errorf("unknown scoring strategy %q", p.Strategy)
+	}
+	if (p.Strategy == scoringLinearDecay || p.Strategy == scoringExponentialDecay) && contestStart.IsZero() {
+		return fmt.Errorf("%s needs schedule.start_at", p.Strategy)
+	}
+	return nil
+}
+
+// countSolves returns how many teams solved questionID. Organisers testing
+// questions do not count. Caller holds stateMu.
+func countSolves(users map[string]*UserState, questionID int) int {
+	n := 0
+	for username, us := range users {
+		if usersByUsername[username].IsAdmin() {
+			continue
+		}
+		if qs, ok := us.PerQuestion[questionID]; ok && qs.AttemptHistory.Solved() {
+			n++
+		}
+	}
+	return n
+}
+
+// questionSolver is a team that solved a question, with the attempt that did.
+type questionSolver struct {
+	username string
+	index    int // in AttemptHistory
+	at       time.Time
+}
+
+// questionSolvers lists the teams that solved questionID in solve order,
+// organisers left out. Caller holds stateMu.
+func questionSolvers(users map[string]*UserState, questionID int) []questionSolver {
+	var solvers []questionSolver
+	for username, us := range users {
+		if usersByUsername[username].IsAdmin() {
+			continue
+		}
+		qs, ok := us.PerQuestion[questionID]
+		if !ok {
+			continue
+		}
+		for i, attempt := range qs.AttemptHistory {
+			if attempt.Correct {
+				solvers = append(solvers, questionSolver{username, i, attempt.At})
+				break
+			}
+		}
+	}
+	sort.Slice(solvers, func(i, j int) bool {
+		if !solvers[i].at.Equal(solvers[j].at) {
+			return solvers[i].at.Before(solvers[j].at)
+		}
+		return solvers[i].username < solvers[j].username
+	})
+	return solvers
+}
+
+// scoreAdjustment changes the points of an earlier solve of a dynamic
+// question, it is recorded with the solve that caused it.
+type scoreAdjustment struct {
+	Username   string `json:"username"`
+	Index      int    `json:"index"` // of the solving attempt in AttemptHistory
+	Score      int    `json:"score"`
+	TotalScore int    `json:"total_score"`
+}
+
+// dynamicAdjustments revalues the solves of a dynamic question q for when one
+// more team solves it. Caller holds stateMu.
+func dynamicAdjustments(users map[string]*UserState, q Question) []scoreAdjustment {
+	solvers := questionSolvers(users, q.ID)
+	var adjustments []scoreAdjustment
+	for position, solver := range solvers {
+		us := users[solver.username]
+		old := us.PerQuestion[q.ID].AttemptHistory[solver.index].Score
+		score := q.dynamicScore(len(solvers)+1, position)
+		if score == old {
+			continue
+		}
+		adjustments = append(adjustments, scoreAdjustment{
+			Username:   solver.username,
+			Index:      solver.index,
+			Score:      score,
+			TotalScore: applyScoreDelta(us.TotalScore, score-old),
+		})
+	}
+	return adjustments
+}
+
+// dynamicScoresAsOf returns what every solve of a dynamic question was
+// worth at asOf, question id -> username -> points. Caller holds stateMu.
+func dynamicScoresAsOf(users map[string]*UserState, questions map[int]Question, asOf time.Time) map[int]map[string]int {
+	scores := map[int]map[string]int{}
+	for _, q := range questions {
+		if !q.isDynamic() {
+			continue
+		}
+		var solved []questionSolver
+		for _, solver := range questionSolvers(users, q.ID) {
+			if !solver.at.After(asOf) {
+				solved = append(solved, solver)
+			}
+		}
+		scores[q.ID] = make(map[string]int, len(solved))
+		for position, solver := range solved {
+			scores[q.ID][solver.username] = q.dynamicScore(len(solved), position)
+		}
+	}
+	return scores
+}
+
+// applyScoreDelta adds delta to total, the total score never drops below zero.
+func applyScoreDelta(total, delta int) int {
+	return max(total+delta, 0)
+}
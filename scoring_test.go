@@ -0,0 +1,240 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setContestStart(t *testing.T, start time.Time) {
+	t.Helper()
+	old := contestStart
+	contestStart = start
+	t.Cleanup(func() { contestStart = old })
+}
+
+func TestSolveScore(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	setContestStart(t, start)
+	at := func(minutes float64) time.Time {
+		return start.Add(time.Duration(minutes * float64(time.Minute)))
+	}
+
+	linear := &ScoringPolicy{Strategy: scoringLinearDecay, DecayPerMinute: 0.5, MinScore: 20}
+	exponential := &ScoringPolicy{Strategy: scoringExponentialDecay, HalfLifeMinutes: 60, MinScore: 20}
+	dynamic := &ScoringPolicy{Strategy: scoringDynamic, DecaySolves: 10, MinScore: 20}
+
+	tests := []struct {
+		name    string
+		scoring *ScoringPolicy
+		ctx     solveContext
+		want    int
+	}{
+		{"no policy", nil, solveContext{At: at(500), Solves: 50}, 100},
+		{"static", &ScoringPolicy{Strategy: scoringStatic}, solveContext{At: at(500), Solves: 50}, 100},
+		{"linear at the start", linear, solveContext{At: at(0)}, 100},
+		{"linear before the start", linear, solveContext{At: at(-30)}, 100},
+		{"linear after 30 minutes", linear, solveContext{At: at(30)}, 85},
+		{"linear rounds up", linear, solveContext{At: at(31)}, 85},
+		{"linear floor", linear, solveContext{At: at(600)}, 20},
+		{"exponential at the start", exponential, solveContext{At: at(0)}, 100},
+		{"exponential one half-life", exponential, solveContext{At: at(60)}, 50},
+		{"exponential two half-lives", exponential, solveContext{At: at(120)}, 25},
+		{"exponential floor", exponential, solveContext{At: at(180)}, 20},
+		{"dynamic first solve", dynamic, solveContext{At: at(0), Solves: 0}, 100},
+		{"dynamic halfway", dynamic, solveContext{At: at(0), Solves: 5}, 80},
+		{"dynamic at decay_solves", dynamic, solveContext{At: at(0), Solves: 10}, 20},
+		{"dynamic past decay_solves", dynamic, solveContext{At: at(0), Solves: 30}, 20},
+		{"first solve bonus", &ScoringPolicy{Bonuses: []int{30, 20, 10}}, solveContext{Solves: 0}, 130},
+		{"third solve bonus", &ScoringPolicy{Bonuses: []int{30, 20, 10}}, solveContext{Solves: 2}, 110},
+		{"no bonus left", &ScoringPolicy{Bonuses: []int{30, 20, 10}}, solveContext{Solves: 3}, 100},
+		{
+			"bonus on top of the floor",
+			&ScoringPolicy{Strategy: scoringLinearDecay, DecayPerMinute: 1, MinScore: 20, Bonuses: []int{5}},
+			solveContext{At: at(600), Solves: 0},
+			25,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := Question{ID: 1, Score: 100, Scoring: tt.scoring}
+			if err := tt.scoring.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if got := q.solveScore(tt.ctx); got != tt.want {
+				t.Errorf("solveScore = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoringPolicyValidate(t *testing.T) {
+	setContestStart(t, time.Time{})
+	tests := []struct {
+		name    string
+		p       *ScoringPolicy
+		wantErr string
+	}{
+		{"nil", nil, ""},
+		{"bonuses only", &ScoringPolicy{Bonuses: []int{3, 2, 1}}, ""},
+		{"negative min", &ScoringPolicy{MinScore: -1}, "min_score"},
+		{"negative bonus", &ScoringPolicy{Bonuses: []int{-1}}, "bonuses"},
+		{"unknown", &ScoringPolicy{Strategy: "solve_decay"}, "unknown scoring strategy"},
+		{"linear without rate", &ScoringPolicy{Strategy: scoringLinearDecay}, "decay_per_minute"},
+		{"linear without start", &ScoringPolicy{Strategy: scoringLinearDecay, DecayPerMinute: 1}, "schedule.start_at"},
+		{"exponential without half-life", &ScoringPolicy{Strategy: scoringExponentialDecay}, "half_life_minutes"},
+		{"dynamic without solves", &ScoringPolicy{Strategy: scoringDynamic}, "decay_solves"},
+		{"dynamic needs no start", &ScoringPolicy{Strategy: scoringDynamic, DecaySolves: 5}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluateAttempt(t *testing.T) {
+	q := Question{ID: 1, Answer: "x", Score: 10, Penalty: 2, PenaltyTryCount: 1}
+	wrong := AttemptRecord{QuestionID: 1, Answer: "y"}
+	right := AttemptRecord{QuestionID: 1, Answer: "x", Correct: true}
+
+	tests := []struct {
+		name   string
+		answer string
+		prior  AttemptRecords
+		want   attemptOutcome
+	}{
+		{"correct", "x", nil, attemptOutcome{Correct: true, ScoreDelta: 10}},
+		{"wrong", "y", nil, attemptOutcome{PenaltyApplied: true, ScoreDelta: -2}},
+		{"correct after wrong", "x", AttemptRecords{wrong}, attemptOutcome{Correct: true, ScoreDelta: 10}},
+		{"already solved", "x", AttemptRecords{right}, attemptOutcome{Correct: true, AlreadySolved: true}},
+		{"wrong after solving", "y", AttemptRecords{right}, attemptOutcome{Correct: true, AlreadySolved: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluateAttempt(q, "a", tt.answer, tt.prior, solveContext{}); got != tt.want {
+				t.Errorf("evaluateAttempt = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountSolves(t *testing.T) {
+	oldUsers := usersByUsername
+	usersByUsername = map[string]User{"org": {Username: "org", Role: roleAdmin}}
+	t.Cleanup(func() { usersByUsername = oldUsers })
+
+	solved := func() *UserState {
+		return &UserState{PerQuestion: map[int]*UserQuestionState{
+			1: {AttemptHistory: AttemptRecords{{QuestionID: 1}, {QuestionID: 1, Correct: true}}},
+		}}
+	}
+	users := map[string]*UserState{
+		"a":   solved(),
+		"b":   solved(),
+		"c":   {PerQuestion: map[int]*UserQuestionState{1: {AttemptHistory: AttemptRecords{{QuestionID: 1}}}}},
+		"org": solved(),
+	}
+	if got := countSolves(users, 1); got != 2 {
+		t.Errorf("countSolves = %d, want 2", got)
+	}
+	if got := countSolves(users, 2); got != 0 {
+		t.Errorf("countSolves of an unsolved question = %d, want 0", got)
+	}
+}
+
+func TestApplyScoreDelta(t *testing.T) {
+	tests := []struct{ total, delta, want int }{
+		{10, 5, 15},
+		{10, -5, 5},
+		{3, -5, 0},
+		{0, -1, 0},
+	}
+	for _, tt := range tests {
+		if got := applyScoreDelta(tt.total, tt.delta); got != tt.want {
+			t.Errorf("applyScoreDelta(%d, %d) = %d, want %d", tt.total, tt.delta, got, tt.want)
+		}
+	}
+}
+
+func TestDynamicScoring(t *testing.T) {
+	q := Question{ID: 1, Answer: "x", Score: 100, Scoring: &ScoringPolicy{Strategy: scoringDynamic, DecaySolves: 2, MinScore: 20, Bonuses: []int{10}}}
+	store := setupHandlerTest(t, map[int]Question{1: q})
+
+	// after each solve, every solver's total in solve order
+	want := [][]int{{110}, {90, 80}, {30, 20, 20}}
+	for i, username := range []string{"a", "b", "c"} {
+		if status, resp := checkAnswer(ensureUserState(username), q, "x"); status != http.StatusOK || !resp.OK {
+			t.Fatalf("solve by %s = %d %+v", username, status, resp)
+		}
+		for j, w := range want[i] {
+			solver := []string{"a", "b", "c"}[j]
+			if got := state.Users[solver].TotalScore; got != w {
+				t.Errorf("after %d solves %s has %d, want %d", i+1, solver, got, w)
+			}
+			if got := state.Users[solver].PerQuestion[1].AttemptHistory[0].Score; got != w {
+				t.Errorf("after %d solves %s's solve is worth %d, want %d", i+1, solver, got, w)
+			}
+		}
+	}
+
+	// the journal alone rebuilds the same scores
+	replayed := newTestState(0)
+	for _, e := range store.events {
+		applyEvent(replayed, e)
+	}
+	for username, us := range state.Users {
+		if got := replayed.Users[username].TotalScore; got != us.TotalScore {
+			t.Errorf("journal replay gives %s %d, want %d", username, got, us.TotalScore)
+		}
+	}
+
+	// and so does rescoring
+	if diffs := previewRescore(); len(diffs) != 0 {
+		t.Errorf("rescore would change %+v", diffs)
+	}
+
+	// the frozen view counts solves until the freeze only
+	freeze := state.Users["b"].PerQuestion[1].AttemptHistory[0].At
+	board := buildScoreboard(freeze)
+	for _, entry := range board {
+		wantFrozen := map[string]int{"a": 90, "b": 80, "c": 0}[entry.Username]
+		if entry.TotalScore != wantFrozen {
+			t.Errorf("frozen %s = %d, want %d", entry.Username, entry.TotalScore, wantFrozen)
+		}
+	}
+}
+
+func TestReplayScoresDynamic(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	solve := func(minute int) *UserQuestionState {
+		return &UserQuestionState{AttemptHistory: AttemptRecords{{QuestionID: 1, Answer: "x", Correct: true, At: start.Add(time.Duration(minute) * time.Minute)}}}
+	}
+	// recorded with static scoring, the question became dynamic since
+	users := map[string]*UserState{
+		"a": {Username: "a", TotalScore: 100, PerQuestion: map[int]*UserQuestionState{1: solve(1)}},
+		"b": {Username: "b", TotalScore: 100, PerQuestion: map[int]*UserQuestionState{1: solve(2)}},
+	}
+	q := Question{ID: 1, Answer: "x", Score: 100, Scoring: &ScoringPolicy{Strategy: scoringDynamic, DecaySolves: 4, MinScore: 20}}
+	results := replayScores(users, map[int]Question{1: q})
+
+	// two solves: 100 + (20-100)/16 * 1 = 95 for both
+	for _, username := range []string{"a", "b"} {
+		if got := results[username].TotalScore; got != 95 {
+			t.Errorf("%s = %d, want 95", username, got)
+		}
+		if got := results[username].Outcomes[1][0].ScoreDelta; got != 95 {
+			t.Errorf("%s's solve = %d, want 95", username, got)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "fmt"
+
+// -------- Storage backends --------
+
+const (
+	storageJSON   = "json"
+	storageSQLite = "sqlite"
+)
+
+// Store is where users, questions and user state are kept between restarts.
+// The in-memory state stays the working copy; the store only has to make it
+// durable and give it back on startup.
+type Store interface {
+	LoadUsers() ([]User, error)
+	LoadQuestions() ([]Question, error)
+	SaveQuestions(questions []Question) error
+
+	// LoadState returns the last saved state with all stored events applied.
+	LoadState() (*InMemoryState, error)
+	// AppendEvent durably records an attempt or prompt before it is applied in memory.
+	AppendEvent(e stateEvent) error
+	// SaveState writes a full snapshot, e.g. after a rescore changed past attempts.
+	// st is a private copy, events newer than st.JournalSeq may already be stored.
+	SaveState(st *InMemoryState) error
+
+	Close() error
+}
+
+var dataStore Store
+
+func newStore(cfg *Config) (Store, error) {
+	switch cfg.Storage {
+	case storageJSON:
+		return newJSONStore(cfg), nil
+	case storageSQLite:
+		return newSQLiteStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage)
+	}
+}
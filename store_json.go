@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// jsonStore keeps everything in the files under assets/: users.json,
+// questions.json, a state.json snapshot and the write-ahead journal.
+type jsonStore struct {
+	usersPath     string
+	questionsPath string
+	statePath     string
+	journalPath   string
+
+	journal *journal
+}
+
+func newJSONStore(cfg *Config) *jsonStore {
+	return &jsonStore{
+		usersPath:     cfg.UsersFilePath,
+		questionsPath: cfg.QuestionsFilePath,
+		statePath:     cfg.StateFilePath,
+		journalPath:   cfg.JournalFilePath,
+	}
+}
+
+func (s *jsonStore) LoadUsers() ([]User, error) {
+	var list []User
+	if err := readJSONFile(s.usersPath, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *jsonStore) LoadQuestions() ([]Question, error) {
+	var list []Question
+	if err := readJSONFile(s.questionsPath, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *jsonStore) SaveQuestions(questions []Question) error {
+	data, err := json.MarshalIndent(questions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.questionsPath, append(data, '\n'), 0644)
+}
+
+func (s *jsonStore) LoadState() (*InMemoryState, error) {
+	loaded := &InMemoryState{}
+	// Load persisted state if present
+	if err := readJSONFile(s.statePath, loaded); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", s.statePath, err)
+		}
+		log.Printf("no existing state to load: %v", err)
+	}
+	if loaded.Users == nil {
+		loaded.Users = map[string]*UserState{}
+	}
+
+	applied, err := replayJournal(s.journalPath, loaded)
+	if err != nil {
+		return nil, fmt.Errorf("replay %s: %w", s.journalPath, err)
+	}
+	if applied > 0 {
+		log.Printf("replayed %d journal entries", applied)
+	}
+
+	s.journal, err = openJournal(s.journalPath)
+	if err != nil {
+		return nil, err
+	}
+	// start from a fresh snapshot and an empty journal, compact also drops a torn last entry
+	if err := s.SaveState(loaded); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+func (s *jsonStore) AppendEvent(e stateEvent) error {
+	return s.journal.append(e)
+}
+
+func (s *jsonStore) SaveState(st *InMemoryState) error {
+	var writer bytes.Buffer
+
+	enc := json.NewEncoder(&writer)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(st)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(s.statePath, writer.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return s.journal.compact(st.JournalSeq)
+}
+
+func (s *jsonStore) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.Close()
+}
+
+func readJSONFile(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(v)
+}
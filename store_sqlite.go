@@ -0,0 +1,743 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStore keeps everything in one SQLite database so results can be
+// queried with SQL after the event. On first start an empty database is
+// seeded from users.json, questions.json and the JSON state if present.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	username TEXT PRIMARY KEY,
+	password TEXT NOT NULL,
+	role     TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS questions (
+	id   INTEGER PRIMARY KEY,
+	data TEXT NOT NULL -- the question as JSON, use json_extract to query it
+);
+CREATE TABLE IF NOT EXISTS user_scores (
+	username             TEXT PRIMARY KEY,
+	total_score          INTEGER NOT NULL,
+	last_solved_question INTEGER NOT NULL,
+	seq                  INTEGER NOT NULL DEFAULT 0 -- of the last event that changed the score
+);
+CREATE TABLE IF NOT EXISTS attempts (
+	username    TEXT NOT NULL,
+	question_id INTEGER NOT NULL,
+	idx         INTEGER NOT NULL,
+	answer      TEXT NOT NULL,
+	correct     INTEGER NOT NULL,
+	at          TEXT NOT NULL,
+	seq         INTEGER NOT NULL DEFAULT 0,
+	score       INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (username, question_id, idx)
+);
+CREATE TABLE IF NOT EXISTS prompts (
+	username         TEXT NOT NULL,
+	question_id      INTEGER NOT NULL,
+	idx              INTEGER NOT NULL,
+	user_prompt      TEXT NOT NULL,
+	system_prompt_id INTEGER NOT NULL,
+	result           TEXT NOT NULL,
+	at               TEXT NOT NULL,
+	seq              INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (username, question_id, idx)
+);
+CREATE TABLE IF NOT EXISTS hint_reveals (
+	username    TEXT NOT NULL,
+	question_id INTEGER NOT NULL,
+	idx         INTEGER NOT NULL,
+	cost        INTEGER NOT NULL,
+	at          TEXT NOT NULL,
+	seq         INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (username, question_id, idx)
+);
+CREATE TABLE IF NOT EXISTS rate_limits (
+	username    TEXT NOT NULL,
+	question_id INTEGER NOT NULL,
+	idx         INTEGER NOT NULL,
+	at          TEXT NOT NULL,
+	retry_after INTEGER NOT NULL,
+	seq         INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (username, question_id, idx)
+);
+-- teams revealed on the frozen scoreboard
+CREATE TABLE IF NOT EXISTS reveals (
+	username TEXT PRIMARY KEY,
+	seq      INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS announcements (
+	id          INTEGER PRIMARY KEY,
+	question_id INTEGER NOT NULL,
+	text        TEXT NOT NULL,
+	author      TEXT NOT NULL,
+	at          TEXT NOT NULL,
+	seq         INTEGER NOT NULL DEFAULT 0
+);
+-- replied_at is NULL until the organisers answered
+CREATE TABLE IF NOT EXISTS clarifications (
+	id          INTEGER PRIMARY KEY,
+	username    TEXT NOT NULL,
+	question_id INTEGER NOT NULL,
+	text        TEXT NOT NULL,
+	at          TEXT NOT NULL,
+	reply       TEXT NOT NULL DEFAULT '',
+	public      INTEGER NOT NULL DEFAULT 0,
+	replied_by  TEXT NOT NULL DEFAULT '',
+	replied_at  TEXT,
+	seq         INTEGER NOT NULL DEFAULT 0
+);
+-- sequence number of the last stored event, 'unfrozen' once the scoreboard is
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`
+
+// sqliteColumns were added after databases were already in use, CREATE TABLE
+// IF NOT EXISTS does not add them to existing tables.
+var sqliteColumns = []struct{ table, column, definition string }{
+	{"attempts", "seq", "INTEGER NOT NULL DEFAULT 0"},
+	{"prompts", "seq", "INTEGER NOT NULL DEFAULT 0"},
+	{"attempts", "score", "INTEGER NOT NULL DEFAULT 0"},
+	{"user_scores", "seq", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+func newSQLiteStore(cfg *Config) (*sqliteStore, error) {
+	dsn := "file:" + cfg.SQLiteFilePath + "?_journal_mode=WAL&_synchronous=FULL&_busy_timeout=5000"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// all writes already happen under stateMu, one connection keeps SQLite happy
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &sqliteStore{db: db}
+	if err := s.addMissingColumns(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	if err := s.seed(cfg); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("seed from json files: %w", err)
+	}
+	return s, nil
+}
+
+// seed fills empty tables from the JSON files, so switching an existing
+// event to SQLite keeps its users, questions and progress.
+func (s *sqliteStore) seed(cfg *Config) error {
+	if empty, err := s.tableEmpty("users"); err != nil {
+		return err
+	} else if empty {
+		var users []User
+		if err := readJSONFile(cfg.UsersFilePath, &users); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := s.saveUsers(users); err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			log.Printf("sqlite: imported %d users from %s", len(users), cfg.UsersFilePath)
+		}
+	}
+
+	if empty, err := s.tableEmpty("questions"); err != nil {
+		return err
+	} else if empty {
+		var questions []Question
+		if err := readJSONFile(cfg.QuestionsFilePath, &questions); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := s.SaveQuestions(questions); err != nil {
+			return err
+		}
+		if len(questions) > 0 {
+			log.Printf("sqlite: imported %d questions from %s", len(questions), cfg.QuestionsFilePath)
+		}
+	}
+
+	if empty, err := s.tableEmpty("user_scores"); err != nil {
+		return err
+	} else if empty {
+		loaded := &InMemoryState{}
+		if err := readJSONFile(cfg.StateFilePath, loaded); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if loaded.Users == nil {
+			loaded.Users = map[string]*UserState{}
+		}
+		if _, err := replayJournal(cfg.JournalFilePath, loaded); err != nil {
+			return err
+		}
+		if err := s.SaveState(loaded); err != nil {
+			return err
+		}
+		log.Printf("sqlite: imported state of %d users from %s", len(loaded.Users), cfg.StateFilePath)
+	}
+	return nil
+}
+
+func (s *sqliteStore) addMissingColumns() error {
+	for _, c := range sqliteColumns {
+		var n int
+		err := s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := s.db.Exec("ALTER TABLE " + c.table + " ADD COLUMN " + c.column + " " + c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) tableEmpty(table string) (bool, error) {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		return false, err
+	}
+	return n == 0, nil
+}
+
+func (s *sqliteStore) saveUsers(users []User) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, u := range users {
+			if u.Username == "" {
+				continue
+			}
+			_, err := tx.Exec(`INSERT INTO users (username, password, role) VALUES (?, ?, ?)
+				ON CONFLICT (username) DO UPDATE SET password = excluded.password, role = excluded.role`,
+				u.Username, u.Password, u.Role)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) LoadUsers() ([]User, error) {
+	rows, err := s.db.Query("SELECT username, password, role FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.Username, &u.Password, &u.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqliteStore) LoadQuestions() ([]Question, error) {
+	rows, err := s.db.Query("SELECT data FROM questions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var questions []Question
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var q Question
+		if err := json.Unmarshal([]byte(data), &q); err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+func (s *sqliteStore) SaveQuestions(questions []Question) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM questions"); err != nil {
+			return err
+		}
+		for _, q := range questions {
+			data, err := json.Marshal(q)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("INSERT INTO questions (id, data) VALUES (?, ?)", q.ID, string(data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) LoadState() (*InMemoryState, error) {
+	st := &InMemoryState{Users: map[string]*UserState{}}
+	user := func(username string) *UserState {
+		us, ok := st.Users[username]
+		if !ok {
+			us = &UserState{Username: username, PerQuestion: map[int]*UserQuestionState{}}
+			st.Users[username] = us
+		}
+		return us
+	}
+	question := func(us *UserState, id int) *UserQuestionState {
+		qs, ok := us.PerQuestion[id]
+		if !ok {
+			qs = &UserQuestionState{AttemptHistory: []AttemptRecord{}}
+			us.PerQuestion[id] = qs
+		}
+		return qs
+	}
+
+	if err := s.db.QueryRow("SELECT COALESCE(MAX(value), 0) FROM meta WHERE key = 'seq'").Scan(&st.JournalSeq); err != nil {
+		return nil, err
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) > 0 FROM meta WHERE key = 'unfrozen'").Scan(&st.Unfrozen); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT username FROM reveals")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if st.Revealed == nil {
+			st.Revealed = map[string]bool{}
+		}
+		st.Revealed[username] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT id, question_id, text, author, at FROM announcements ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var a Announcement
+		var at string
+		if err := rows.Scan(&a.ID, &a.QuestionID, &a.Text, &a.Author, &at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if a.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		st.Announcements = append(st.Announcements, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT id, username, question_id, text, at, reply, public, replied_by, replied_at FROM clarifications ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var cl Clarification
+		var at string
+		var repliedAt sql.NullString
+		if err := rows.Scan(&cl.ID, &cl.Username, &cl.QuestionID, &cl.Text, &at, &cl.Reply, &cl.Public, &cl.RepliedBy, &repliedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if cl.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if repliedAt.Valid {
+			t, err := time.Parse(time.RFC3339Nano, repliedAt.String)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			cl.RepliedAt = &t
+		}
+		st.Clarifications = append(st.Clarifications, cl)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT username, total_score, last_solved_question FROM user_scores")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var username string
+		var total, last int
+		if err := rows.Scan(&username, &total, &last); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		us := user(username)
+		us.TotalScore = total
+		us.LastSolvedQuestion = last
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT username, question_id, answer, correct, at, score FROM attempts ORDER BY username, question_id, idx")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var username, at string
+		var record AttemptRecord
+		if err := rows.Scan(&username, &record.QuestionID, &record.Answer, &record.Correct, &at, &record.Score); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if record.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		qs := question(user(username), record.QuestionID)
+		qs.AttemptHistory = append(qs.AttemptHistory, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT username, question_id, user_prompt, system_prompt_id, result, at FROM prompts ORDER BY username, question_id, idx")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var username, at string
+		var questionID int
+		var record PromptRecord
+		if err := rows.Scan(&username, &questionID, &record.UserPrompt, &record.SystemPromptID, &record.Result, &at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if record.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		qs := question(user(username), questionID)
+		qs.PromptHistory = append(qs.PromptHistory, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT username, question_id, idx, cost, at FROM hint_reveals ORDER BY username, question_id, idx")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var username, at string
+		var questionID int
+		var record HintReveal
+		if err := rows.Scan(&username, &questionID, &record.Index, &record.Cost, &at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if record.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		qs := question(user(username), questionID)
+		qs.HintReveals = append(qs.HintReveals, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT username, question_id, at, retry_after FROM rate_limits ORDER BY username, question_id, idx")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var username, at string
+		var questionID int
+		var record RateLimitRecord
+		if err := rows.Scan(&username, &questionID, &at, &record.RetryAfterSeconds); err != nil {
+			return nil, err
+		}
+		if record.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, err
+		}
+		qs := question(user(username), questionID)
+		qs.RateLimits = append(qs.RateLimits, record)
+	}
+	return st, rows.Err()
+}
+
+func (s *sqliteStore) AppendEvent(e stateEvent) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := setSeq(tx, e.Seq); err != nil {
+			return err
+		}
+		switch e.Type {
+		case eventAttempt:
+			_, err := tx.Exec(`INSERT INTO attempts (username, question_id, idx, answer, correct, at, seq, score)
+				VALUES (?, ?, (SELECT COALESCE(MAX(idx) + 1, 0) FROM attempts WHERE username = ? AND question_id = ?), ?, ?, ?, ?, ?)`,
+				e.Username, e.QuestionID, e.Username, e.QuestionID,
+				e.Attempt.Answer, e.Attempt.Correct, e.Attempt.At.Format(time.RFC3339Nano), e.Seq, e.Attempt.Score)
+			if err != nil {
+				return err
+			}
+			for _, a := range e.Adjustments {
+				_, err := tx.Exec("UPDATE attempts SET score = ? WHERE username = ? AND question_id = ? AND idx = ?",
+					a.Score, a.Username, e.QuestionID, a.Index)
+				if err != nil {
+					return err
+				}
+				_, err = tx.Exec("UPDATE user_scores SET total_score = ?, seq = ? WHERE username = ?", a.TotalScore, e.Seq, a.Username)
+				if err != nil {
+					return err
+				}
+			}
+			return upsertUserScore(tx, e.Username, e.TotalScore, e.LastSolvedQuestion, e.Seq)
+		case eventPrompt:
+			_, err := tx.Exec(`INSERT INTO prompts (username, question_id, idx, user_prompt, system_prompt_id, result, at, seq)
+				VALUES (?, ?, (SELECT COALESCE(MAX(idx) + 1, 0) FROM prompts WHERE username = ? AND question_id = ?), ?, ?, ?, ?, ?)`,
+				e.Username, e.QuestionID, e.Username, e.QuestionID,
+				e.Prompt.UserPrompt, e.Prompt.SystemPromptID, e.Prompt.Result, e.Prompt.At.Format(time.RFC3339Nano), e.Seq)
+			return err
+		case eventHint:
+			_, err := tx.Exec(`INSERT INTO hint_reveals (username, question_id, idx, cost, at, seq) VALUES (?, ?, ?, ?, ?, ?)`,
+				e.Username, e.QuestionID, e.Hint.Index, e.Hint.Cost, e.Hint.At.Format(time.RFC3339Nano), e.Seq)
+			if err != nil {
+				return err
+			}
+			return upsertUserScore(tx, e.Username, e.TotalScore, e.LastSolvedQuestion, e.Seq)
+		case eventRateLimit:
+			_, err := tx.Exec(`INSERT INTO rate_limits (username, question_id, idx, at, retry_after, seq)
+				VALUES (?, ?, (SELECT COALESCE(MAX(idx) + 1, 0) FROM rate_limits WHERE username = ? AND question_id = ?), ?, ?, ?)`,
+				e.Username, e.QuestionID, e.Username, e.QuestionID,
+				e.RateLimit.At.Format(time.RFC3339Nano), e.RateLimit.RetryAfterSeconds, e.Seq)
+			return err
+		case eventReveal:
+			_, err := tx.Exec("INSERT OR IGNORE INTO reveals (username, seq) VALUES (?, ?)", e.Username, e.Seq)
+			return err
+		case eventUnfreeze:
+			return setUnfrozen(tx)
+		case eventAnnouncement:
+			a := e.Announcement
+			_, err := tx.Exec("INSERT INTO announcements (id, question_id, text, author, at, seq) VALUES (?, ?, ?, ?, ?, ?)",
+				a.ID, a.QuestionID, a.Text, a.Author, a.At.Format(time.RFC3339Nano), e.Seq)
+			return err
+		case eventClarification, eventClarificationReply:
+			return upsertClarification(tx, *e.Clarification, e.Seq)
+		default:
+			return fmt.Errorf("unknown event type %q", e.Type)
+		}
+	})
+}
+
+// SaveState upserts every user's score and history. Stored attempts only
+// change their correctness and score, which is what a rescore rewrites. Scores of users
+// with events newer than the snapshot are left alone, those rows are newer.
+func (s *sqliteStore) SaveState(st *InMemoryState) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		newer := map[string]bool{}
+		rows, err := tx.Query(`SELECT username FROM attempts WHERE seq > ?1
+			UNION SELECT username FROM prompts WHERE seq > ?1
+			UNION SELECT username FROM hint_reveals WHERE seq > ?1
+			UNION SELECT username FROM user_scores WHERE seq > ?1`, st.JournalSeq)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var username string
+			if err := rows.Scan(&username); err != nil {
+				rows.Close()
+				return err
+			}
+			newer[username] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if err := setSeq(tx, st.JournalSeq); err != nil {
+			return err
+		}
+		for username := range st.Revealed {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO reveals (username) VALUES (?)", username); err != nil {
+				return err
+			}
+		}
+		if st.Unfrozen {
+			if err := setUnfrozen(tx); err != nil {
+				return err
+			}
+		}
+		for _, a := range st.Announcements {
+			_, err := tx.Exec("INSERT OR IGNORE INTO announcements (id, question_id, text, author, at) VALUES (?, ?, ?, ?, ?)",
+				a.ID, a.QuestionID, a.Text, a.Author, a.At.Format(time.RFC3339Nano))
+			if err != nil {
+				return err
+			}
+		}
+		for _, cl := range st.Clarifications {
+			if err := upsertClarification(tx, cl, 0); err != nil {
+				return err
+			}
+		}
+
+		attemptStmt, err := tx.Prepare(`INSERT INTO attempts (username, question_id, idx, answer, correct, at, score)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (username, question_id, idx) DO UPDATE SET correct = excluded.correct, score = excluded.score
+			WHERE correct <> excluded.correct OR score <> excluded.score`)
+		if err != nil {
+			return err
+		}
+		defer attemptStmt.Close()
+		// a newer event may have changed the score of a stored attempt
+		newAttemptStmt, err := tx.Prepare(`INSERT OR IGNORE INTO attempts (username, question_id, idx, answer, correct, at, score)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer newAttemptStmt.Close()
+		promptStmt, err := tx.Prepare(`INSERT OR IGNORE INTO prompts (username, question_id, idx, user_prompt, system_prompt_id, result, at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer promptStmt.Close()
+		hintStmt, err := tx.Prepare(`INSERT OR IGNORE INTO hint_reveals (username, question_id, idx, cost, at) VALUES (?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer hintStmt.Close()
+		rateLimitStmt, err := tx.Prepare(`INSERT OR IGNORE INTO rate_limits (username, question_id, idx, at, retry_after) VALUES (?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer rateLimitStmt.Close()
+
+		for username, us := range st.Users {
+			stmt := newAttemptStmt
+			if !newer[username] {
+				stmt = attemptStmt
+				if err := upsertUserScore(tx, username, us.TotalScore, us.LastSolvedQuestion, st.JournalSeq); err != nil {
+					return err
+				}
+			}
+			for questionID, qs := range us.PerQuestion {
+				for i, a := range qs.AttemptHistory {
+					if _, err := stmt.Exec(username, questionID, i, a.Answer, a.Correct, a.At.Format(time.RFC3339Nano), a.Score); err != nil {
+						return err
+					}
+				}
+				for i, p := range qs.PromptHistory {
+					if _, err := promptStmt.Exec(username, questionID, i, p.UserPrompt, p.SystemPromptID, p.Result, p.At.Format(time.RFC3339Nano)); err != nil {
+						return err
+					}
+				}
+				for _, h := range qs.HintReveals {
+					if _, err := hintStmt.Exec(username, questionID, h.Index, h.Cost, h.At.Format(time.RFC3339Nano)); err != nil {
+						return err
+					}
+				}
+				for i, r := range qs.RateLimits {
+					if _, err := rateLimitStmt.Exec(username, questionID, i, r.At.Format(time.RFC3339Nano), r.RetryAfterSeconds); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func upsertUserScore(tx *sql.Tx, username string, total, lastSolved int, seq int64) error {
+	_, err := tx.Exec(`INSERT INTO user_scores (username, total_score, last_solved_question, seq) VALUES (?, ?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET total_score = excluded.total_score,
+			last_solved_question = excluded.last_solved_question, seq = MAX(seq, excluded.seq)`,
+		username, total, lastSolved, seq)
+	return err
+}
+
+// setSeq raises the stored event sequence number to seq.
+func setSeq(tx *sql.Tx, seq int64) error {
+	_, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('seq', ?)
+		ON CONFLICT (key) DO UPDATE SET value = MAX(value, excluded.value)`, seq)
+	return err
+}
+
+// upsertClarification stores cl, a reply overwrites the stored one. A snapshot
+// (seq 0) never replaces a newer reply.
+func upsertClarification(tx *sql.Tx, cl Clarification, seq int64) error {
+	var repliedAt sql.NullString
+	if cl.RepliedAt != nil {
+		repliedAt = sql.NullString{String: cl.RepliedAt.Format(time.RFC3339Nano), Valid: true}
+	}
+	_, err := tx.Exec(`INSERT INTO clarifications (id, username, question_id, text, at, reply, public, replied_by, replied_at, seq)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET reply = excluded.reply, public = excluded.public,
+			replied_by = excluded.replied_by, replied_at = excluded.replied_at, seq = MAX(seq, excluded.seq)
+		WHERE excluded.seq > 0 OR seq = 0`,
+		cl.ID, cl.Username, cl.QuestionID, cl.Text, cl.At.Format(time.RFC3339Nano),
+		cl.Reply, cl.Public, cl.RepliedBy, repliedAt, seq)
+	return err
+}
+
+func setUnfrozen(tx *sql.Tx) error {
+	_, err := tx.Exec("INSERT OR IGNORE INTO meta (key, value) VALUES ('unfrozen', 1)")
+	return err
+}
+
+func (s *sqliteStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// the schema as the first SQLite release created it
+const sqliteSchemaV1 = `
+CREATE TABLE users (
+	username TEXT PRIMARY KEY,
+	password TEXT NOT NULL,
+	role     TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE questions (
+	id   INTEGER PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE user_scores (
+	username             TEXT PRIMARY KEY,
+	total_score          INTEGER NOT NULL,
+	last_solved_question INTEGER NOT NULL
+);
+CREATE TABLE attempts (
+	username    TEXT NOT NULL,
+	question_id INTEGER NOT NULL,
+	idx         INTEGER NOT NULL,
+	answer      TEXT NOT NULL,
+	correct     INTEGER NOT NULL,
+	at          TEXT NOT NULL,
+	PRIMARY KEY (username, question_id, idx)
+);
+CREATE TABLE prompts (
+	username         TEXT NOT NULL,
+	question_id      INTEGER NOT NULL,
+	idx              INTEGER NOT NULL,
+	user_prompt      TEXT NOT NULL,
+	system_prompt_id INTEGER NOT NULL,
+	result           TEXT NOT NULL,
+	at               TEXT NOT NULL,
+	PRIMARY KEY (username, question_id, idx)
+);
+INSERT INTO users (username, password) VALUES ('a', 'x');
+INSERT INTO user_scores VALUES ('a', 10, 1);
+INSERT INTO attempts VALUES ('a', 1, 0, 'answer', 1, '2025-01-01T10:00:00Z');
+`
+
+func TestSQLiteStoreMigratesOldDatabase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "competition.db")
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(sqliteSchemaV1); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	cfg := defaultConfig()
+	cfg.SQLiteFilePath = path
+	cfg.UsersFilePath = filepath.Join(dir, "users.json")
+	cfg.QuestionsFilePath = filepath.Join(dir, "questions.json")
+	cfg.StateFilePath = filepath.Join(dir, "state.json")
+	cfg.JournalFilePath = filepath.Join(dir, "state.journal")
+	s, err := newSQLiteStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	st, err := s.LoadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(st.Users["a"].PerQuestion[1].AttemptHistory); got != 1 {
+		t.Fatalf("attempts after migration = %d, want 1", got)
+	}
+
+	e := testAttemptEvent(st.JournalSeq+1, "a", 2, false, 10)
+	if err := s.AppendEvent(e); err != nil {
+		t.Fatalf("append to migrated attempts: %v", err)
+	}
+	e = stateEvent{
+		Seq:        e.Seq + 1,
+		Type:       eventPrompt,
+		Username:   "a",
+		QuestionID: 2,
+		Prompt:     &PromptRecord{UserPrompt: "hi", SystemPromptID: 1, Result: "hello", At: e.Attempt.At},
+	}
+	if err := s.AppendEvent(e); err != nil {
+		t.Fatalf("append to migrated prompts: %v", err)
+	}
+}
+
+func newTestSQLiteStore(t *testing.T) *sqliteStore {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.SQLiteFilePath = filepath.Join(dir, "competition.db")
+	cfg.UsersFilePath = filepath.Join(dir, "users.json")
+	cfg.QuestionsFilePath = filepath.Join(dir, "questions.json")
+	cfg.StateFilePath = filepath.Join(dir, "state.json")
+	cfg.JournalFilePath = filepath.Join(dir, "state.journal")
+	s, err := newSQLiteStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStoreScoreAdjustments(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	st, err := s.LoadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := testAttemptEvent(1, "a", 1, true, 100)
+	first.Attempt.Score = 100
+	if err := s.AppendEvent(first); err != nil {
+		t.Fatal(err)
+	}
+	applyEvent(st, first)
+	// a snapshot taken before b's solve devalued a's
+	snapshot := st.Users["a"].TotalScore
+
+	second := testAttemptEvent(2, "b", 1, true, 80)
+	second.Attempt.Score = 80
+	second.Adjustments = []scoreAdjustment{{Username: "a", Index: 0, Score: 80, TotalScore: 80}}
+	if err := s.AppendEvent(second); err != nil {
+		t.Fatal(err)
+	}
+	old := newTestState(1)
+	old.Users["a"] = &UserState{Username: "a", TotalScore: snapshot, LastSolvedQuestion: 1, PerQuestion: map[int]*UserQuestionState{
+		1: {AttemptHistory: AttemptRecords{*first.Attempt}},
+	}}
+	if err := s.SaveState(old); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := s.LoadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := loaded.Users["a"]
+	if a.TotalScore != 80 || a.PerQuestion[1].AttemptHistory[0].Score != 80 {
+		t.Errorf("a = %d with a solve worth %d, want the adjusted 80", a.TotalScore, a.PerQuestion[1].AttemptHistory[0].Score)
+	}
+}
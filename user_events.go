@@ -0,0 +1,357 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// -------- Per-user event stream --------
+
+const (
+	userEventAttempt = "attempt" // a submission was judged
+	userEventPenalty = "penalty" // a wrong answer cost points
+	userEventHint    = "hint"    // a hint was revealed
+	userEventPhase   = "phase"   // the competition phase changed, sent on connect too
+
+	userEventAnnouncement         = "announcement"
+	userEventClarification        = "clarification"         // a reply to the team, or a public one to everyone
+	userEventClarificationRequest = "clarification_request" // to organisers, a team asked
+
+	userEventBuffer = 32 // events queued per connection before it is dropped
+	wsWriteTimeout  = 10 * time.Second
+	wsPongTimeout   = 60 * time.Second
+	wsPingInterval  = wsPongTimeout * 9 / 10
+)
+
+// userEvent is one message on a user's WebSocket.
+type userEvent struct {
+	Type string    `json:"type"`
+	At   time.Time `json:"at"`
+	Data any       `json:"data"`
+}
+
+type attemptEventData struct {
+	QuestionID int  `json:"question_id"`
+	Correct    bool `json:"correct"`
+	Score      int  `json:"score"`
+	TotalScore int  `json:"total_score"`
+}
+
+type penaltyEventData struct {
+	QuestionID int `json:"question_id"`
+	Penalty    int `json:"penalty"`
+	TotalScore int `json:"total_score"`
+}
+
+type hintEventData struct {
+	QuestionID int    `json:"question_id"`
+	Index      int    `json:"index"`
+	Text       string `json:"text"`
+	Cost       int    `json:"cost"`
+	TotalScore int    `json:"total_score"`
+}
+
+type phaseEventData struct {
+	Phase string `json:"phase"`
+}
+
+// userEventHub fans events out to the WebSocket connections of each user.
+// A user may be connected from several devices. Publishing never blocks,
+// connections that fall behind are closed and the client reconnects.
+type userEventHub struct {
+	cfg *Config
+
+	mu          sync.Mutex
+	subscribers map[string]map[*userSubscriber]struct{}
+	phase       string
+	closed      bool
+
+	done chan struct{}
+}
+
+type userSubscriber struct {
+	username string
+	events   chan userEvent
+}
+
+var userEvents *userEventHub
+
+func newUserEventHub(cfg *Config) *userEventHub {
+	return &userEventHub{
+		cfg:         cfg,
+		subscribers: map[string]map[*userSubscriber]struct{}{},
+		phase:       cfg.Schedule.Phase(time.Now()),
+		done:        make(chan struct{}),
+	}
+}
+
+func (h *userEventHub) Start() {
+	go h.watchPhase()
+}
+
+// watchPhase tells everyone when the schedule moves to another phase.
+func (h *userEventHub) watchPhase() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			phase := h.cfg.Schedule.Phase(now)
+			h.mu.Lock()
+			changed := phase != h.phase
+			h.phase = phase
+			h.mu.Unlock()
+			if changed {
+				h.PublishAll(userEvent{Type: userEventPhase, At: now, Data: phaseEventData{Phase: phase}})
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// Publish queues e for every connection of username.
+func (h *userEventHub) Publish(username string, e userEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers[username] {
+		h.send(sub, e)
+	}
+}
+
+// PublishAll queues e for every connection.
+func (h *userEventHub) PublishAll(e userEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			h.send(sub, e)
+		}
+	}
+}
+
+// PublishEach queues an event of type for every connection, with the data
+// dataFor returns for the connection's user.
+func (h *userEventHub) PublishEach(dataFor func(username string) any, eventType string, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for username, subs := range h.subscribers {
+		e := userEvent{Type: eventType, At: at, Data: dataFor(username)}
+		for sub := range subs {
+			h.send(sub, e)
+		}
+	}
+}
+
+// send drops sub if its queue is full. Caller holds h.mu.
+func (h *userEventHub) send(sub *userSubscriber, e userEvent) {
+	select {
+	case sub.events <- e:
+	default:
+		log.Printf("events: dropping slow connection of %q", sub.username)
+		h.remove(sub)
+	}
+}
+
+func (h *userEventHub) remove(sub *userSubscriber) {
+	subs, ok := h.subscribers[sub.username]
+	if _, found := subs[sub]; !ok || !found {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.username)
+	}
+	close(sub.events)
+}
+
+// Subscribe registers a connection of username, nil once the hub is closed.
+func (h *userEventHub) Subscribe(username string) *userSubscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	sub := &userSubscriber{username: username, events: make(chan userEvent, userEventBuffer)}
+	if h.subscribers[username] == nil {
+		h.subscribers[username] = map[*userSubscriber]struct{}{}
+	}
+	h.subscribers[username][sub] = struct{}{}
+	sub.events <- userEvent{Type: userEventPhase, At: time.Now(), Data: phaseEventData{Phase: h.phase}}
+	return sub
+}
+
+func (h *userEventHub) Unsubscribe(sub *userSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// Close ends every connection. WebSockets are hijacked, Shutdown would not
+// wait for them but would not close them either.
+func (h *userEventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// publishStateEvent tells the user what a recorded state event did to them.
+// Caller holds stateMu.
+func publishStateEvent(e stateEvent) {
+	if userEvents == nil {
+		return
+	}
+	switch e.Type {
+	case eventAttempt:
+		userEvents.Publish(e.Username, userEvent{Type: userEventAttempt, At: e.Attempt.At, Data: attemptEventData{
+			QuestionID: e.QuestionID,
+			Correct:    e.Attempt.Correct,
+			Score:      e.Attempt.Score,
+			TotalScore: e.TotalScore,
+		}})
+		if e.Attempt.Score < 0 {
+			userEvents.Publish(e.Username, userEvent{Type: userEventPenalty, At: e.Attempt.At, Data: penaltyEventData{
+				QuestionID: e.QuestionID,
+				Penalty:    -e.Attempt.Score,
+				TotalScore: e.TotalScore,
+			}})
+		}
+	case eventHint:
+		data := hintEventData{QuestionID: e.QuestionID, Index: e.Hint.Index, Cost: e.Hint.Cost, TotalScore: e.TotalScore}
+		if q, ok := getQuestion(e.QuestionID); ok && e.Hint.Index < len(q.Hints) {
+			data.Text = q.Hints[e.Hint.Index].Text
+		}
+		userEvents.Publish(e.Username, userEvent{Type: userEventHint, At: e.Hint.At, Data: data})
+	case eventAnnouncement:
+		userEvents.PublishAll(userEvent{Type: userEventAnnouncement, At: e.Announcement.At, Data: e.Announcement})
+	case eventClarification:
+		for username, user := range usersByUsername {
+			if user.IsAdmin() {
+				userEvents.Publish(username, userEvent{Type: userEventClarificationRequest, At: e.Clarification.At, Data: e.Clarification})
+			}
+		}
+	case eventClarificationReply:
+		cl := *e.Clarification
+		if !cl.Public {
+			userEvents.Publish(cl.Username, userEvent{Type: userEventClarification, At: *cl.RepliedAt, Data: cl})
+			return
+		}
+		userEvents.PublishEach(func(username string) any {
+			if username == cl.Username || usersByUsername[username].IsAdmin() {
+				return cl
+			}
+			return publicClarification(cl)
+		}, userEventClarification, *cl.RepliedAt)
+	}
+}
+
+// cookieTokenFallback lets browsers authenticate the WebSocket handshake,
+// they cannot set the token header there but send the login cookie.
+func cookieTokenFallback(cfg *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Header.Get(cfg.JWTCookieName) == "" {
+			if token, err := c.Cookie(cfg.JWTCookieName); err == nil {
+				c.Request.Header.Set(cfg.JWTCookieName, token)
+			}
+		}
+		c.Next()
+	}
+}
+
+// newUpgrader accepts handshakes from allowed_origins and the server's own
+// host. The cookie makes the handshake credentialed, any other site could
+// open the socket as the user otherwise.
+func newUpgrader(cfg *Config) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			for _, allowed := range cfg.AllowedOrigins {
+				if origin == allowed {
+					return true
+				}
+			}
+			u, err := url.Parse(origin)
+			return err == nil && u.Host == r.Host
+		},
+	}
+}
+
+// userEventsHandler upgrades to a WebSocket that carries the user's own
+// events as JSON text messages. Messages from the client are ignored.
+func userEventsHandler(cfg *Config) gin.HandlerFunc {
+	upgrader := newUpgrader(cfg)
+	return func(c *gin.Context) {
+		claims := c.MustGet(claimsKey).(*Claims)
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// the upgrader already answered with an error status
+			return
+		}
+		defer conn.Close()
+
+		sub := userEvents.Subscribe(claims.Username)
+		if sub == nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"),
+				time.Now().Add(wsWriteTimeout))
+			return
+		}
+		defer userEvents.Unsubscribe(sub)
+
+		// the reader only handles control frames and notices when the client leaves
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			conn.SetReadLimit(512)
+			conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+			})
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case e, ok := <-sub.events:
+				conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				if !ok {
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+					return
+				}
+				if err := conn.WriteJSON(e); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}
+}
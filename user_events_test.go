@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// startUserEvents serves /ws for the users a, b and organiser and returns
+// its ws:// URL and a token per user.
+func startUserEvents(t *testing.T) (*Config, string, map[string]string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	oldUsers, oldHub := usersByUsername, userEvents
+	usersByUsername = map[string]User{
+		"a":         {Username: "a"},
+		"b":         {Username: "b"},
+		"organiser": {Username: "organiser", Role: roleAdmin},
+	}
+	cfg := &Config{
+		JWTSecret:      strings.Repeat("s", minJWTSecretLength),
+		JWTCookieName:  "Quiz-Token",
+		JWTExpiration:  time.Hour,
+		AllowedOrigins: []string{"https://quiz.example"},
+	}
+	userEvents = newUserEventHub(cfg)
+
+	r := gin.New()
+	r.GET("/ws", cookieTokenFallback(cfg), JWTAuthMiddleware(cfg), userEventsHandler(cfg))
+	srv := httptest.NewServer(r)
+	t.Cleanup(func() {
+		userEvents.Close()
+		srv.Close()
+		usersByUsername, userEvents = oldUsers, oldHub
+	})
+
+	tokens := map[string]string{}
+	for username, user := range usersByUsername {
+		token, _, err := generateJWT(cfg, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[username] = token
+	}
+	return cfg, "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws", tokens
+}
+
+type wsEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func readWSEvent(t *testing.T, conn *websocket.Conn) wsEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var e wsEvent
+	if err := conn.ReadJSON(&e); err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	return e
+}
+
+// dialUserEvents connects and reads the phase event sent on subscribing, so
+// the connection is registered with the hub when it returns.
+func dialUserEvents(t *testing.T, url string, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial: %v (status %d)", err, status)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if e := readWSEvent(t, conn); e.Type != userEventPhase {
+		t.Fatalf("first event = %s, want phase", e.Type)
+	}
+	return conn
+}
+
+func TestUserEventsOnlyOwnEvents(t *testing.T) {
+	cfg, url, tokens := startUserEvents(t)
+	header := func(username string) http.Header {
+		return http.Header{cfg.JWTCookieName: {tokens[username]}}
+	}
+	a := dialUserEvents(t, url, header("a"))
+	b := dialUserEvents(t, url, header("b"))
+	organiser := dialUserEvents(t, url, header("organiser"))
+
+	at := time.Now()
+	publishStateEvent(stateEvent{Type: eventAttempt, Username: "a", QuestionID: 1, TotalScore: 10,
+		Attempt: &AttemptRecord{QuestionID: 1, Correct: true, Score: 10, At: at}})
+	publishStateEvent(stateEvent{Type: eventClarification, Username: "a",
+		Clarification: &Clarification{ID: 1, Username: "a", Text: "why?", At: at}})
+	publishStateEvent(stateEvent{Type: eventAnnouncement, Announcement: &Announcement{ID: 1, Text: "hello", At: at}})
+
+	// each connection sees its own events in order, then the announcement
+	want := map[*websocket.Conn][]string{
+		a:         {userEventAttempt, userEventAnnouncement},
+		b:         {userEventAnnouncement},
+		organiser: {userEventClarificationRequest, userEventAnnouncement},
+	}
+	for conn, types := range want {
+		for _, typ := range types {
+			if e := readWSEvent(t, conn); e.Type != typ {
+				t.Errorf("event = %s %s, want %s", e.Type, e.Data, typ)
+			}
+		}
+	}
+}
+
+func TestUserEventsHandshake(t *testing.T) {
+	cfg, url, tokens := startUserEvents(t)
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantStatus int // of a refused handshake, 0 when it succeeds
+	}{
+		{"token header", http.Header{cfg.JWTCookieName: {tokens["a"]}}, 0},
+		{"login cookie", http.Header{"Cookie": {cfg.JWTCookieName + "=" + tokens["a"]}}, 0},
+		{"no token", http.Header{}, http.StatusUnauthorized},
+		{"bad cookie", http.Header{"Cookie": {cfg.JWTCookieName + "=nope"}}, http.StatusUnauthorized},
+		{"allowed origin", http.Header{cfg.JWTCookieName: {tokens["a"]}, "Origin": {"https://quiz.example"}}, 0},
+		{"own host", http.Header{cfg.JWTCookieName: {tokens["a"]}, "Origin": {"http" + strings.TrimSuffix(strings.TrimPrefix(url, "ws"), "/ws")}}, 0},
+		{"foreign origin", http.Header{"Cookie": {cfg.JWTCookieName + "=" + tokens["a"]}, "Origin": {"https://evil.example"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, resp, err := websocket.DefaultDialer.Dial(url, tt.header)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("dial: %v", err)
+				}
+				defer conn.Close()
+				if e := readWSEvent(t, conn); e.Type != userEventPhase {
+					t.Errorf("first event = %s, want phase", e.Type)
+				}
+				return
+			}
+			if err == nil {
+				conn.Close()
+				t.Fatal("handshake succeeded")
+			}
+			if resp == nil || resp.StatusCode != tt.wantStatus {
+				t.Errorf("handshake refused with %v, want status %d", resp, tt.wantStatus)
+			}
+		})
+	}
+}